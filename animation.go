@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/esimov/legoizer/drawer"
+	proc "github.com/esimov/legoizer/processor"
+)
+
+// animation holds the frames of an animated image or of an image sequence.
+type animation struct {
+	frames []image.Image
+	// delay is the delay of each frame, in 100ths of a second.
+	delay []int
+	loop  int
+	// first is the number of the first frame of an image sequence.
+	first int
+}
+
+// sequenceVerb matches the frame number verb of an image sequence pattern, e.g. %d or %04d.
+var sequenceVerb = regexp.MustCompile(`%0?\d*d`)
+
+// isSequence checks if the path is a numbered image sequence pattern, e.g. frame_%04d.png.
+func isSequence(path string) bool {
+	return sequenceVerb.MatchString(path)
+}
+
+// loadAnimation loads all the frames of a GIF image or of an image sequence, each frame being shown for the delay.
+// The other image formats are loaded as a single frame. The path "-" reads the image from the standard input.
+func loadAnimation(path string, delay int) (*animation, error) {
+	if isSequence(path) {
+		return loadSequence(path, delay)
+	}
+	animated := strings.ToLower(filepath.Ext(path)) == ".gif"
+	if path == stdio {
+		// Detect the format of the standard input from its content.
+		f, err := openInput(path)
+		if err != nil {
+			return nil, err
+		}
+		_, format, err := image.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			return nil, decodeError(err)
+		}
+		animated = format == "gif"
+	}
+	if !animated {
+		img, err := loadImage(path)
+		if err != nil {
+			return nil, err
+		}
+		return &animation{frames: []image.Image{img}, delay: []int{0}}, nil
+	}
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return &animation{frames: composeFrames(g), delay: g.Delay, loop: g.LoopCount}, nil
+}
+
+// loadSequence loads the frames of a numbered image sequence. The sequence starts with the frame 0 or 1
+// and ends with the last frame before a missing number.
+func loadSequence(pattern string, delay int) (*animation, error) {
+	a := &animation{}
+	if _, err := os.Stat(fmt.Sprintf(pattern, 0)); err != nil {
+		a.first = 1
+	}
+	for i := a.first; ; i++ {
+		path := fmt.Sprintf(pattern, i)
+		if _, err := os.Stat(path); err != nil {
+			break
+		}
+		img, err := loadImage(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		a.frames = append(a.frames, img)
+		a.delay = append(a.delay, delay)
+	}
+	if len(a.frames) == 0 {
+		return nil, fmt.Errorf("no frame found for %s", pattern)
+	}
+	return a, nil
+}
+
+// composeFrames renders the full canvas of each GIF frame,
+// since a frame might update only a part of the canvas and has to be disposed of before the next one.
+func composeFrames(g *gif.GIF) []image.Image {
+	var (
+		frames []image.Image
+		bounds = image.Rect(0, 0, g.Config.Width, g.Config.Height)
+		canvas = image.NewRGBA(bounds)
+	)
+	if bounds.Empty() {
+		bounds = g.Image[0].Bounds()
+		canvas = image.NewRGBA(bounds)
+	}
+	for i, frame := range g.Image {
+		var previous *image.RGBA
+		if i < len(g.Disposal) && g.Disposal[i] == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			copy(previous.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		img := image.NewRGBA(bounds)
+		copy(img.Pix, canvas.Pix)
+		frames = append(frames, img)
+
+		if i < len(g.Disposal) {
+			switch g.Disposal[i] {
+			case gif.DisposalBackground:
+				draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+			case gif.DisposalPrevious:
+				canvas = previous
+			}
+		}
+	}
+	return frames
+}
+
+// generateSequence writes the frames as a numbered image sequence, keeping the numbers of the source frames.
+func generateSequence(a *animation, pattern, format string, enc encoding) error {
+	for i, frame := range a.frames {
+		if err := generateImage(frame, fmt.Sprintf(pattern, a.first+i), format, enc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateAnimation writes the frames as an animated GIF, to the standard output if the path is "-".
+// All the frames are quantized together to the same 255 colors palette, so the colors do not flicker,
+// plus a transparent entry for the pixels more transparent than the alpha threshold.
+func generateAnimation(a *animation, outPath string, alphaThreshold uint8) error {
+	var (
+		q  = proc.Quant{AlphaThreshold: alphaThreshold}
+		pi = q.Quantize(drawer.Montage(a.frames), 255).(*image.Paletted)
+		g  = &gif.GIF{LoopCount: a.loop}
+		y  int
+	)
+	for i, frame := range a.frames {
+		// Each frame is the montage region it was drawn on.
+		b := frame.Bounds()
+		g.Image = append(g.Image, &image.Paletted{
+			Pix:     pi.Pix[y*pi.Stride:],
+			Stride:  pi.Stride,
+			Rect:    image.Rect(0, 0, b.Dx(), b.Dy()),
+			Palette: pi.Palette,
+		})
+		g.Delay = append(g.Delay, a.delay[i])
+		g.Disposal = append(g.Disposal, gif.DisposalNone)
+		y += b.Dy()
+	}
+	return writeOutput(outPath, func(w io.Writer) error { return gif.EncodeAll(w, g) })
+}
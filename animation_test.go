@@ -0,0 +1,83 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateAnimationSharesPalette(t *testing.T) {
+	a := &animation{loop: 0}
+	for i := 0; i < 3; i++ {
+		frame := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+		for y := 0; y < 10; y++ {
+			for x := 0; x < 20; x++ {
+				frame.Set(x, y, color.NRGBA{R: uint8(x * 12), G: uint8(i * 80), B: 0x40, A: 0xff})
+			}
+		}
+		a.frames = append(a.frames, frame)
+		a.delay = append(a.delay, 10)
+	}
+	dir, err := ioutil.TempDir("", "legoizer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.gif")
+	if err := generateAnimation(a, path, 0); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != len(a.frames) {
+		t.Fatalf("got %d frames, want %d", len(g.Image), len(a.frames))
+	}
+	for i, pi := range g.Image {
+		if !reflect.DeepEqual(pi.Palette, g.Image[0].Palette) {
+			t.Errorf("frame %d: the palette differs from the first frame palette", i)
+		}
+		if pi.Bounds() != a.frames[i].Bounds() {
+			t.Errorf("frame %d: got bounds %v, want %v", i, pi.Bounds(), a.frames[i].Bounds())
+		}
+		// The frames hold few colors, so they are encoded without loss.
+		for y := 0; y < 10; y++ {
+			for x := 0; x < 20; x++ {
+				want := color.NRGBAModel.Convert(a.frames[i].At(x, y))
+				if got := color.NRGBAModel.Convert(pi.At(x, y)); got != want {
+					t.Fatalf("frame %d at %d,%d: got %v, want %v", i, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestIsSequence(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"frame_%04d.png", true},
+		{"frame_%d.png", true},
+		{"out/%3d.jpg", true},
+		{"100%.png", false},
+		{"50%_off.png", false},
+		{"frame.png", false},
+	}
+	for _, tt := range tests {
+		if got := isSequence(tt.path); got != tt.want {
+			t.Errorf("isSequence(%q): got %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
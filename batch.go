@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/esimov/legoizer/drawer"
+)
+
+// imageExts are the file extensions of the images processed from a batch directory.
+var imageExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+	".bmp": true, ".tif": true, ".tiff": true, ".webp": true,
+}
+
+// result is the outcome of a batch job.
+type result struct {
+	in      string
+	bounds  image.Rectangle
+	colors  int
+	bricks  int
+	elapsed time.Duration
+	err     error
+}
+
+// isBatch checks if the input path is a directory or a glob pattern.
+func isBatch(path string) bool {
+	if isSequence(path) {
+		return false
+	}
+	if fi, err := os.Stat(path); err == nil {
+		return fi.IsDir()
+	}
+	return strings.ContainsAny(path, "*?[")
+}
+
+// batchInputs returns the images of a directory or the files matching a glob pattern, sorted by name.
+func batchInputs(path string) ([]string, error) {
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		files, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		var inputs []string
+		for _, f := range files {
+			if !f.IsDir() && imageExts[strings.ToLower(filepath.Ext(f.Name()))] {
+				inputs = append(inputs, filepath.Join(path, f.Name()))
+			}
+		}
+		return inputs, nil
+	}
+	inputs, err := filepath.Glob(path)
+	sort.Strings(inputs)
+	return inputs, err
+}
+
+// expandName expands the output file name template for an input file.
+// The template accepts the {name} (input file name without extension), {ext} (input file extension)
+// and {index} (position of the input in the batch, starting from 1) placeholders.
+func expandName(tmpl, in string, index int) string {
+	ext := filepath.Ext(in)
+	return strings.NewReplacer(
+		"{name}", strings.TrimSuffix(filepath.Base(in), ext),
+		"{ext}", ext,
+		"{index}", strconv.Itoa(index),
+	).Replace(tmpl)
+}
+
+// job holds the output paths of a batch input.
+type job struct {
+	out  string
+	opts options
+}
+
+// batchJobs expands the output file name template and the export paths for each input.
+// It fails if two inputs write the same file, since one output would silently overwrite the other,
+// or if an output would overwrite one of the inputs.
+func batchJobs(inputs []string, opts options, outDir, tmpl string) ([]job, error) {
+	var (
+		jobs    = make([]job, len(inputs))
+		writers = make(map[string]string)
+		sources = make(map[string]bool)
+	)
+	for _, in := range inputs {
+		abs, err := filepath.Abs(in)
+		if err != nil {
+			return nil, err
+		}
+		sources[abs] = true
+	}
+	for i, in := range inputs {
+		o := opts
+		for _, path := range []*string{&o.ldraw, &o.mesh, &o.parts, &o.instr} {
+			if *path != "" {
+				*path = filepath.Join(outDir, expandName(*path, in, i+1))
+			}
+		}
+		out := filepath.Join(outDir, expandName(tmpl, in, i+1))
+		paths := []string{out, o.ldraw, o.mesh, o.parts, o.instr}
+		if strings.ToLower(filepath.Ext(o.mesh)) == ".obj" {
+			paths = append(paths, mtlPath(o.mesh))
+		}
+		for _, path := range paths {
+			if path == "" {
+				continue
+			}
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return nil, err
+			}
+			if sources[abs] {
+				return nil, fmt.Errorf("%s would overwrite an input image, write the outputs into another directory or change their names", path)
+			}
+			if w, ok := writers[path]; ok {
+				return nil, fmt.Errorf("%s is written by both %s and %s, use the {ext} or {index} placeholder to tell the outputs apart", path, w, in)
+			}
+			writers[path] = in
+		}
+		jobs[i] = job{out: out, opts: o}
+	}
+	return jobs, nil
+}
+
+// runBatch legoizes all the inputs in parallel, writing the outputs into the output directory.
+// The output file names and the export paths are templates expanded for each input.
+func runBatch(quant drawer.Quantizer, opts options, inPath, outDir, tmpl string, workers int) []result {
+	inputs, err := batchInputs(inPath)
+	if err != nil || len(inputs) == 0 {
+		return []result{{in: inPath, err: fmt.Errorf("no image found: %v", inPath)}}
+	}
+	batch, err := batchJobs(inputs, opts, outDir, tmpl)
+	if err != nil {
+		return []result{{in: inPath, err: err}}
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return []result{{in: inPath, err: err}}
+	}
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	var (
+		results = make([]result, len(inputs))
+		jobs    = make(chan int)
+		wg      sync.WaitGroup
+		done    int32
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var (
+					in  = inputs[i]
+					q   = quant
+					now = time.Now()
+				)
+				bounds, err := legoize(&q, batch[i].opts, in, batch[i].out)
+				results[i] = result{in: in, bounds: bounds, colors: len(q.Used), elapsed: time.Since(now), err: err}
+				for _, layer := range q.Layers {
+					results[i].bricks += len(layer)
+				}
+				fmt.Printf("  %d/%d %s\n", atomic.AddInt32(&done, 1), len(inputs), in)
+			}
+		}()
+	}
+	for i := range inputs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// printSummary prints the batch results as a table.
+func printSummary(w io.Writer, results []result) {
+	var (
+		tw     = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		failed int
+		total  time.Duration
+	)
+	fmt.Fprintln(tw, "FILE\tSIZE\tCOLORS\tBRICKS\tTIME\tERROR")
+	for _, r := range results {
+		errMsg := ""
+		if r.err != nil {
+			errMsg = r.err.Error()
+			failed++
+		}
+		total += r.elapsed
+		fmt.Fprintf(tw, "%s\t%dx%d\t%d\t%d\t%.2fs\t%s\n",
+			r.in, r.bounds.Dx(), r.bounds.Dy(), r.colors, r.bricks, r.elapsed.Seconds(), errMsg)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "%d files, %d failed, %.2fs of processing\n", len(results), failed, total.Seconds())
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandName(t *testing.T) {
+	tests := []struct {
+		tmpl, in string
+		index    int
+		want     string
+	}{
+		{"{name}.png", "dir/a.jpg", 1, "a.png"},
+		{"{name}{ext}.png", "dir/a.jpg", 1, "a.jpg.png"},
+		{"{index}-{name}.gif", "a.b.png", 12, "12-a.b.gif"},
+		{"out.png", "a.png", 3, "out.png"},
+	}
+	for _, tt := range tests {
+		if got := expandName(tt.tmpl, tt.in, tt.index); got != tt.want {
+			t.Errorf("expandName(%q, %q, %d): got %q, want %q", tt.tmpl, tt.in, tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestBatchJobs(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs []string
+		tmpl   string
+		opts   options
+		err    bool
+	}{
+		{"distinct names", []string{"a.jpg", "b.png"}, "{name}.png", options{ldraw: "{name}.ldr"}, false},
+		{"same name", []string{"a.jpg", "a.png"}, "{name}.png", options{}, true},
+		{"same name with extension", []string{"a.jpg", "a.png"}, "{name}{ext}.png", options{}, false},
+		{"same name with index", []string{"a.jpg", "a.png"}, "{index}.png", options{}, false},
+		{"same export", []string{"a.jpg", "b.png"}, "{name}.png", options{parts: "parts.csv"}, true},
+		{"export over output", []string{"a.jpg"}, "{name}.png", options{instr: "a.png"}, true},
+		{"material library", []string{"a.jpg"}, "{name}.png", options{mesh: "{name}.obj", ldraw: "a.mtl"}, true},
+		{"input overwritten", []string{"out/a.png", "out/b.png"}, "{name}.png", options{}, true},
+		{"input overwritten by an export", []string{"out/a.png"}, "{name}.jpg", options{parts: "{name}.png"}, true},
+		{"input directory", []string{"out/a.png"}, "{name}.jpg", options{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs, err := batchJobs(tt.inputs, tt.opts, "out", tt.tmpl)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if !tt.err && jobs[0].out != filepath.Join("out", expandName(tt.tmpl, tt.inputs[0], 1)) {
+				t.Errorf("got output %q", jobs[0].out)
+			}
+		})
+	}
+}
@@ -1,84 +1,483 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"image"
+	"image/color"
 	"image/jpeg"
 	"image/png"
-	"log"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
-	"time"
+	"strings"
 
 	"github.com/esimov/legoizer/drawer"
+	"github.com/esimov/legoizer/palette"
+	proc "github.com/esimov/legoizer/processor"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
 )
 
+// The exit codes of the commands.
+const (
+	exitOK = iota
+	// exitFailure is returned when the processing fails.
+	exitFailure
+	// exitUsage is returned on invalid command-line arguments. It's also the flag package exit code.
+	exitUsage
+)
+
+// command is a legoizer subcommand.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+// commands are the legoizer subcommands, the first one being run when no subcommand is given.
+var commands = []command{
+	{"render", "Generate the legoized image", runRender},
+	{"parts", "Print the parts list of the legoized image", runParts},
+	{"instructions", "Print the building instructions of the legoized image", runInstructions},
+	{"palette", "Palette tools: \"palette extract\" extracts the palette of an image", runPalette},
+	{"inspect", "Print information about an image and its legoized version", runInspect},
+}
+
 func main() {
+	args := os.Args[1:]
+	if len(args) > 0 && strings.HasPrefix(args[0], "-") && !isHelp(args[0]) {
+		// Without command the image is rendered.
+		os.Exit(commands[0].run(args))
+	}
+	if len(args) > 0 {
+		for _, cmd := range commands {
+			if cmd.name == args[0] {
+				os.Exit(cmd.run(args[1:]))
+			}
+		}
+	}
+	usage(os.Stderr)
+	if len(args) > 0 && (args[0] == "help" || isHelp(args[0])) {
+		os.Exit(exitOK)
+	}
+	os.Exit(exitUsage)
+}
+
+// isHelp checks if the argument is a help flag.
+func isHelp(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+// usage prints the list of commands.
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: legoizer <command> [options]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-14s%s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintf(w, "\nRun \"legoizer <command> -h\" for the command options. Without command the image is rendered.\n")
+}
+
+// newFlagSet creates the flag set of a command, printing the command usage on -h.
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: legoizer %s [options]\n\n%s.\n\nOptions:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// settings holds the command-line options shared by the commands processing an image.
+type settings struct {
+	in, weights *string
+
+	legoSize, colors, alpha, layers              *int
+	key, bg, sampling, overrides, remap          *string
+	palPath, sysName, shapes, depth              *string
+	keyTol                                       *float64
+	brightness, contrast, gamma, saturation, hue *float64
+	sharpen, sharpenRad                          *float64
+	fill, autoLevels, equalize, wall             *bool
+	config, saveConfig                           *string
+}
+
+// newSettings registers the image processing options.
+func newSettings(fs *flag.FlagSet) *settings {
+	return &settings{
+		in:       fs.String("in", "", "Input path"),
+		legoSize: fs.Int("size", 0, "Lego size"),
+		colors:   fs.Int("colors", 128, "Number of colors. Maximum number of colors used from the palette with -palette"),
+		alpha:    fs.Int("alpha", 0, "Alpha threshold (0-255) below which cells are left empty. 0 keeps an opaque white background"),
+		key:      fs.String("key", "", "Background key color in hex format or by name (e.g. #00ff00)"),
+		fill:     fs.Bool("fill", false, "Remove only the background connected to the image borders"),
+		keyTol:   fs.Float64("tolerance", 10, "Background key color tolerance in ΔE"),
+		bg:       fs.String("bg", "", "Color replacing the removed background in hex format or by name. Transparent if empty"),
+
+		brightness: fs.Float64("brightness", 0, "Brightness adjustment (-1 to 1)"),
+		contrast:   fs.Float64("contrast", 0, "Contrast adjustment (-1 to 1)"),
+		gamma:      fs.Float64("gamma", 1, "Gamma correction"),
+		saturation: fs.Float64("saturation", 0, "Saturation adjustment (-1 to 1)"),
+		hue:        fs.Float64("hue", 0, "Hue shift in degrees"),
+		autoLevels: fs.Bool("autolevels", false, "Stretch the color channels to the full range"),
+		equalize:   fs.Bool("equalize", false, "Equalize the luminance histogram"),
+		sharpen:    fs.Float64("sharpen", 0, "Unsharp mask amount"),
+		sharpenRad: fs.Float64("sharpen-radius", 1, "Unsharp mask radius in pixels"),
+		sampling:   fs.String("sampling", "box", "Stud color sampling method: box, lanczos, median, mode, kuwahara"),
+		weights:    fs.String("weights", "", "Palette weight map: center, edges or the path of a grayscale mask image"),
+		overrides:  fs.String("overrides", "", "Stud overrides file (JSON or image at stud resolution). The JSON colors are in hex format or by name, the palette color names included"),
+		remap:      fs.String("remap", "", "Palette color remap file with one \"old -> new\" rule per line. A rule only replaces a palette color close to its old color"),
+		palPath:    fs.String("palette", "", "Fixed palette file (.gpl, .act, .ase, .hex, .csv) or \"system\" for the brick system palette. -colors limits the number of palette colors used. The LDraw, mesh, parts list and instructions exports use the system palette if empty"),
+		sysName:    fs.String("system", "standard", "Brick system: standard, duplo, nanoblock, beads"),
+		shapes:     fs.String("shapes", "", "Comma separated list of the allowed shapes, e.g. \"2x4,2x2,1x1\" or \"plate-4x4,plate-1x1\". \"bricks\", \"plates\" and \"all\" select a whole category. Defaults to the bricks, or to the plates in relief mode"),
+		layers:     fs.Int("layers", 1, "Maximum number of layers stacked on a stud. More than one layer builds a relief"),
+		depth:      fs.String("depth", "", "Relief height map image. The height is derived from the luminance if empty"),
+		wall:       fs.Bool("wall", false, "Lay out the bricks as a standing wall with staggered joints, each stud row being a course"),
+		config:     fs.String("config", "", "Project file (.json, .toml, .yaml) holding the option values, keyed by option name. The command-line options override the file values"),
+		saveConfig: fs.String("save-config", "", "Save the effective options into a project file (.json, .toml, .yaml), e.g. next to the outputs to reproduce the run. Nothing is saved unless set"),
+	}
+}
+
+// usageError is an invalid option value, as opposed to a failure to process the input.
+type usageError struct {
+	error
+}
+
+// exitCode returns the exit code of a command failing with the error.
+func exitCode(err error) int {
+	if _, ok := err.(usageError); ok {
+		return exitUsage
+	}
+	return exitFailure
+}
+
+// quantizer creates the quantizer configured by the settings, together with the fixed palette, if any.
+// The invalid option values are reported as usage errors.
+func (s *settings) quantizer() (drawer.Quantizer, palette.Palette, error) {
 	var (
 		quant = drawer.Quantizer{}
-
-		inPath   = flag.String("in", "", "Input path")
-		outPath  = flag.String("out", "", "Output path")
-		legoSize = flag.Int("size", 0, "Lego size")
-		colors   = flag.Int("colors", 128, "Number of colors")
+		pal   palette.Palette
+		err   error
 	)
+	quant.AlphaThreshold = uint8(*s.alpha)
 
-	// Parse the command-line arguments
-	flag.Parse()
+	if *s.key != "" || *s.fill {
+		ck := &proc.ChromaKey{
+			FloodFill: *s.fill,
+			Tolerance: *s.keyTol,
+		}
+		if *s.key != "" {
+			c, err := proc.ParseColor(*s.key)
+			if err != nil {
+				return quant, nil, usageError{fmt.Errorf("invalid key color '%v'", *s.key)}
+			}
+			ck.Key = c
+		}
+		if *s.bg != "" {
+			c, err := proc.ParseColor(*s.bg)
+			if err != nil {
+				return quant, nil, usageError{fmt.Errorf("invalid background color '%v'", *s.bg)}
+			}
+			ck.Replace = c
+		} else if quant.AlphaThreshold == 0 {
+			// Leave the removed background empty.
+			quant.AlphaThreshold = 128
+		}
+		quant.Background = ck
+	}
 
-	img, err := loadImage(*inPath)
+	if *s.autoLevels {
+		quant.Adjust = append(quant.Adjust, proc.AutoLevels{Clip: 0.005})
+	}
+	if *s.equalize {
+		quant.Adjust = append(quant.Adjust, proc.Equalize{})
+	}
+	if *s.brightness != 0 {
+		quant.Adjust = append(quant.Adjust, proc.Brightness(*s.brightness))
+	}
+	if *s.contrast != 0 {
+		quant.Adjust = append(quant.Adjust, proc.Contrast(*s.contrast))
+	}
+	if *s.gamma != 1 {
+		quant.Adjust = append(quant.Adjust, proc.Gamma(*s.gamma))
+	}
+	if *s.saturation != 0 {
+		quant.Adjust = append(quant.Adjust, proc.Saturation(*s.saturation))
+	}
+	if *s.hue != 0 {
+		quant.Adjust = append(quant.Adjust, proc.HueShift(*s.hue))
+	}
+	if *s.sharpen != 0 {
+		quant.Adjust = append(quant.Adjust, proc.UnsharpMask{Radius: *s.sharpenRad, Amount: *s.sharpen})
+	}
+
+	quant.Sampling, err = drawer.ParseSampling(*s.sampling)
 	if err != nil {
-		fmt.Printf("Failed to open image '%v'\n", img)
-		os.Exit(1)
+		return quant, nil, usageError{err}
 	}
 
-	fmt.Println("Generating the legoized image...")
-	now := time.Now()
+	quant.System, err = drawer.LookupSystem(*s.sysName)
+	if err != nil {
+		return quant, nil, usageError{err}
+	}
+	shapes := *s.shapes
+	if shapes == "" {
+		shapes = "bricks"
+		if *s.layers > 1 {
+			shapes = "plates"
+		}
+	}
+	quant.System, err = quant.System.Allow(strings.Split(shapes, ",")...)
+	if err != nil {
+		return quant, nil, usageError{err}
+	}
 
-	res := quant.Process(img, *colors, *legoSize)
-	generateImage(res, *outPath)
+	switch *s.palPath {
+	case "":
+	case "system":
+		pal = quant.System.Palette
+		quant.Palette = pal.Colors()
+	default:
+		pal, err = palette.Load(*s.palPath)
+		if err != nil {
+			return quant, nil, fmt.Errorf("failed to load the palette '%v': %v", *s.palPath, err)
+		}
+		quant.Palette = pal.Colors()
+		// The exports identify the piece colors from the loaded palette.
+		quant.System.Palette = pal
+	}
 
-	since := time.Since(now)
-	fmt.Println("\n  Done✓")
-	fmt.Printf("Generated in: %.2fs\n", since.Seconds())
+	if *s.overrides != "" {
+		quant.Overrides, err = drawer.LoadOverrides(*s.overrides, pal.Names())
+		if err != nil {
+			return quant, nil, fmt.Errorf("failed to load the overrides '%v': %v", *s.overrides, err)
+		}
+	}
+	if *s.remap != "" {
+		quant.Remap, err = proc.LoadRemap(*s.remap, pal.Names())
+		if err != nil {
+			return quant, nil, fmt.Errorf("failed to load the color remap '%v': %v", *s.remap, err)
+		}
+	}
+
+	quant.Wall = *s.wall
+	if *s.layers > 1 {
+		quant.Relief = &drawer.Relief{Layers: *s.layers}
+		if *s.depth != "" {
+			quant.Relief.Depth, err = loadImage(*s.depth)
+			if err != nil {
+				return quant, nil, fmt.Errorf("failed to open height map '%v'", *s.depth)
+			}
+		}
+	}
+	return quant, pal, nil
 }
 
-// loadImage loads an image from a source path.
+// setWeights sets the palette weight map of the image.
+func setWeights(quant *drawer.Quantizer, weights string, img image.Image) error {
+	switch weights {
+	case "":
+	case "center":
+		quant.Weights = proc.CenterWeights(img.Bounds())
+	case "edges":
+		quant.Weights = proc.EdgeWeights(img)
+	default:
+		mask, err := loadImage(weights)
+		if err != nil {
+			return fmt.Errorf("failed to open weight mask '%v': %v", weights, err)
+		}
+		quant.Weights = proc.MaskWeights(mask, img.Bounds())
+	}
+	return nil
+}
+
+// stdio is the path standing for the standard input or the standard output.
+const stdio = "-"
+
+// stdin holds the content of the standard input, which is read only once.
+var stdin []byte
+
+// openInput opens the file at path, or the standard input if the path is "-".
+func openInput(path string) (io.ReadCloser, error) {
+	if path != stdio {
+		return os.Open(path)
+	}
+	if stdin == nil {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		stdin = data
+	}
+	return ioutil.NopCloser(bytes.NewReader(stdin)), nil
+}
+
+// errFormat is returned when the image format is not one of the registered formats.
+var errFormat = errors.New("unsupported image format, the supported formats are JPEG, PNG, GIF, BMP, TIFF and WebP")
+
+// decodeError replaces the unknown format error of the image package with a more explicit one.
+func decodeError(err error) error {
+	if err == image.ErrFormat {
+		return errFormat
+	}
+	return err
+}
+
+// loadImage loads an image from a source path, or from the standard input if the path is "-".
+// JPEG and TIFF images are rotated to their upright position given their EXIF orientation.
 func loadImage(path string) (image.Image, error) {
-	sf, err := os.Open(path)
+	sf, err := openInput(path)
 	if err != nil {
 		return nil, err
 	}
 	defer sf.Close()
-	img, _, err := image.Decode(sf)
+	data, err := ioutil.ReadAll(sf)
 	if err != nil {
 		return nil, err
 	}
-	return img, nil
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, decodeError(err)
+	}
+	return orient(img, exifOrientation(data)), nil
 }
 
-// generateImage generates the resulted image.
-func generateImage(input image.Image, outPath string) error {
-	fq, err := os.Create(outPath)
+// writeFile creates the file at path and writes its content.
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
 	if err != nil {
 		return err
 	}
-	defer fq.Close()
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeOutput writes the content to the file at path, or to the standard output if the path is empty or "-".
+func writeOutput(path string, write func(io.Writer) error) error {
+	if path == "" || path == stdio {
+		return write(os.Stdout)
+	}
+	return writeFile(path, write)
+}
+
+// outputFormat returns the format of the output image: the explicit format if set,
+// otherwise the output file extension. The standard output defaults to PNG.
+func outputFormat(outPath, format string) string {
+	if format == "" {
+		if outPath == stdio {
+			return "png"
+		}
+		format = strings.TrimPrefix(filepath.Ext(outPath), ".")
+	}
+	format = strings.ToLower(format)
+	if format == "jpeg" {
+		return "jpg"
+	}
+	return format
+}
+
+// encoding holds the output image encoder options.
+type encoding struct {
+	// quality is the JPEG quality, from 1 to 100.
+	quality     int
+	compression png.CompressionLevel
+	// paletted writes the PNG images with an 8-bit palette.
+	paletted bool
+	// alphaThreshold is the alpha value below which the pixels of a paletted image are transparent.
+	alphaThreshold uint8
+}
+
+// pngCompressions are the PNG compression levels by name.
+var pngCompressions = map[string]png.CompressionLevel{
+	"default": png.DefaultCompression,
+	"none":    png.NoCompression,
+	"fast":    png.BestSpeed,
+	"best":    png.BestCompression,
+}
 
-	ext := filepath.Ext(fq.Name())
+// newEncoding validates the output image encoder options. The invalid options are reported as usage errors.
+func newEncoding(quality int, compression string, paletted bool, alphaThreshold uint8) (encoding, error) {
+	if quality < 1 || quality > 100 {
+		return encoding{}, usageError{fmt.Errorf("invalid JPEG quality %d, it should be between 1 and 100", quality)}
+	}
+	level, ok := pngCompressions[compression]
+	if !ok {
+		return encoding{}, usageError{fmt.Errorf("invalid PNG compression '%v', it should be one of default, none, fast or best", compression)}
+	}
+	return encoding{
+		quality:        quality,
+		compression:    level,
+		paletted:       paletted,
+		alphaThreshold: alphaThreshold,
+	}, nil
+}
+
+// errWebP is returned for the WebP output format, which has no encoder.
+var errWebP = errors.New("WebP encoding is not supported, write a paletted PNG for a small output")
+
+// checkFormat checks that the output image format is supported.
+func checkFormat(format string) error {
+	switch format {
+	case "png", "jpg", "gif":
+		return nil
+	case "webp":
+		return errWebP
+	}
+	return fmt.Errorf("unsupported output format: %q", format)
+}
 
-	switch ext {
-	case ".jpg", ".jpeg":
-		if err = jpeg.Encode(fq, input, &jpeg.Options{Quality: 100}); err != nil {
-			log.Fatal(err)
-			return err
+// generateImage encodes the resulted image in the given format into the output path, or the standard output if the path is "-".
+func generateImage(input image.Image, outPath, format string, enc encoding) error {
+	var encode func(io.Writer) error
+	switch format {
+	case "jpg":
+		encode = func(w io.Writer) error { return jpeg.Encode(w, input, &jpeg.Options{Quality: enc.quality}) }
+	case "png":
+		if enc.paletted {
+			input = palettedImage(input, enc.alphaThreshold)
 		}
-	case ".png":
-		if err = png.Encode(fq, input); err != nil {
-			log.Fatal(err)
-			return err
+		encoder := png.Encoder{CompressionLevel: enc.compression}
+		encode = func(w io.Writer) error { return encoder.Encode(w, input) }
+	case "webp":
+		return errWebP
+	default:
+		return fmt.Errorf("unsupported output format: %q", format)
+	}
+	return writeOutput(outPath, encode)
+}
+
+// palettedImage converts the image to an 8-bit paletted image. The colors are kept as they are
+// if there are at most 256 of them, otherwise the image is quantized to 255 colors plus a transparent entry.
+func palettedImage(img image.Image, alphaThreshold uint8) *image.Paletted {
+	var (
+		b     = img.Bounds()
+		pal   color.Palette
+		index = make(map[color.Color]uint8)
+		pi    = image.NewPaletted(b, nil)
+	)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y))
+			i, ok := index[c]
+			if !ok {
+				if len(pal) == 256 {
+					q := proc.Quant{AlphaThreshold: alphaThreshold}
+					return q.Quantize(img, 255).(*image.Paletted)
+				}
+				i = uint8(len(pal))
+				index[c] = i
+				pal = append(pal, c)
+			}
+			pi.SetColorIndex(x, y, i)
 		}
 	}
-	return nil
+	pi.Palette = pal
+	return pi
 }
@@ -0,0 +1,70 @@
+package main
+
+import "testing"
+
+func TestCheckOutputFormat(t *testing.T) {
+	tests := []struct {
+		out, format string
+		want        string
+		err         bool
+	}{
+		{"a.png", "", "png", false},
+		{"a.JPEG", "", "jpg", false},
+		{"a.gif", "", "gif", false},
+		{"frame_%04d.png", "", "png", false},
+		{stdio, "", "png", false},
+		{stdio, "jpg", "jpg", false},
+		{"a.png", "gif", "gif", false},
+		{"a.webp", "", "webp", true},
+		{"a.bmp", "", "bmp", true},
+		{"a", "", "", true},
+	}
+	for _, tt := range tests {
+		format := outputFormat(tt.out, tt.format)
+		if format != tt.want {
+			t.Errorf("%q -format %q: got format %q, want %q", tt.out, tt.format, format, tt.want)
+		}
+		if err := checkFormat(format); (err != nil) != tt.err {
+			t.Errorf("%q -format %q: got error %v, want error %v", tt.out, tt.format, err, tt.err)
+		}
+	}
+}
+
+func TestOptionExitCode(t *testing.T) {
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"-system", "lego"}, exitUsage},
+		{[]string{"-shapes", "3x3"}, exitUsage},
+		{[]string{"-sampling", "nearest"}, exitUsage},
+		{[]string{"-key", "nocolor"}, exitUsage},
+		{[]string{"-key", "#00ff00", "-bg", "nocolor"}, exitUsage},
+		{[]string{"-palette", "missing.gpl"}, exitFailure},
+		{[]string{"-overrides", "missing.json"}, exitFailure},
+	}
+	for _, tt := range tests {
+		_, s, err := parseCommand("parts", tt.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = s.quantizer()
+		if err == nil {
+			t.Errorf("%v: got no error", tt.args)
+			continue
+		}
+		if code := exitCode(err); code != tt.want {
+			t.Errorf("%v: got exit code %d, want %d", tt.args, code, tt.want)
+		}
+	}
+
+	for _, enc := range []struct {
+		quality     int
+		compression string
+	}{{0, "default"}, {101, "default"}, {100, "max"}} {
+		_, err := newEncoding(enc.quality, enc.compression, false, 0)
+		if code := exitCode(err); err == nil || code != exitUsage {
+			t.Errorf("-quality %d -compression %q: got error %v, exit code %d", enc.quality, enc.compression, err, code)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/esimov/legoizer/drawer"
+	"github.com/esimov/legoizer/palette"
+)
+
+// layoutImage lays out the bricks of the input image, or of the first frame of an animation,
+// without writing the legoized image. It returns the configured quantizer, the fixed palette and the source image.
+func layoutImage(s *settings) (*drawer.Quantizer, palette.Palette, image.Image, error) {
+	quant, pal, err := s.quantizer()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	anim, err := loadAnimation(*s.in, 0)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to open image '%v': %v", *s.in, err)
+	}
+	img := anim.frames[0]
+	if err := setWeights(&quant, *s.weights, img); err != nil {
+		return nil, nil, nil, err
+	}
+	quant.Quiet = true
+	quant.Process(img, *s.colors, *s.legoSize)
+	return &quant, pal, img, nil
+}
+
+// runParts runs the parts command.
+func runParts(args []string) int {
+	return runList(args, "parts", "Print the parts list of the legoized image, per layer, in CSV format",
+		"Output path. The parts list is printed on the standard output if empty", drawer.WriteParts)
+}
+
+// runInstructions runs the instructions command.
+func runInstructions(args []string) int {
+	return runList(args, "instructions", "Print the building instructions of the legoized image, layer by layer",
+		"Output path. The instructions are printed on the standard output if empty", drawer.WriteInstructions)
+}
+
+// runList runs a command listing the pieces of the legoized image, written by the write function.
+func runList(args []string, name, usage, outUsage string, write func(io.Writer, [][]drawer.Brick, *drawer.BrickSystem) error) int {
+	var (
+		fs      = newFlagSet(name, usage)
+		s       = newSettings(fs)
+		outPath = fs.String("out", "", outUsage)
+	)
+	if err := parseArgs(fs, s, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	// The listed pieces should come in existing colors.
+	if *s.palPath == "" {
+		*s.palPath = "system"
+	}
+	quant, _, _, err := layoutImage(s)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	err = writeOutput(*outPath, func(w io.Writer) error {
+		return write(w, quant.Layers, quant.System)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	warnUncovered(quant)
+	return exitOK
+}
+
+// runPalette runs the palette command. The only palette tool is "extract".
+func runPalette(args []string) int {
+	if len(args) == 0 || args[0] != "extract" {
+		fmt.Fprintf(os.Stderr, "Usage: legoizer palette extract [options]\n\nRun \"legoizer palette extract -h\" for the command options.\n")
+		if len(args) > 0 && isHelp(args[0]) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	var (
+		fs      = newFlagSet("palette extract", "Extract the palette of an image, chosen from the fixed palette if one is set")
+		s       = newSettings(fs)
+		outPath = fs.String("out", "", "Output palette path (.gpl, .act, .hex, .csv). The palette is printed on the standard output in GIMP format if empty")
+	)
+	if err := parseArgs(fs, s, args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	quant, pal, err := s.quantizer()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	img, err := loadImage(*s.in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open image '%v': %v\n", *s.in, err)
+		return exitFailure
+	}
+	if err := setWeights(&quant, *s.weights, img); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	quant.SharePalette([]image.Image{img}, *s.colors)
+
+	var extracted palette.Palette
+	for _, c := range quant.Palette {
+		pc, _ := pal.Lookup(c)
+		extracted = append(extracted, pc)
+	}
+	if *outPath == "" {
+		err = palette.EncodeGPL(os.Stdout, extracted, strings.TrimSuffix(filepath.Base(*s.in), filepath.Ext(*s.in)))
+	} else {
+		err = palette.Save(*outPath, extracted)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// runInspect runs the inspect command.
+func runInspect(args []string) int {
+	var (
+		fs = newFlagSet("inspect", "Print information about an image and its legoized version")
+		s  = newSettings(fs)
+	)
+	if err := parseArgs(fs, s, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	quant, pal, img, err := layoutImage(s)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	f, err := openInput(*s.in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	_, format, err := image.DecodeConfig(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open image '%v': %v\n", *s.in, decodeError(err))
+		return exitFailure
+	}
+	anim, err := loadAnimation(*s.in, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open image '%v': %v\n", *s.in, err)
+		return exitFailure
+	}
+
+	var (
+		b                = img.Bounds()
+		cellSize, gw, gh = drawer.GridSize(b, *s.legoSize)
+		colors           = make(map[color.Color]bool)
+		transparent      bool
+	)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			colors[c] = true
+			transparent = transparent || c.A < 0xff
+		}
+	}
+	fmt.Printf("File:         %s\n", *s.in)
+	fmt.Printf("Format:       %s\n", format)
+	fmt.Printf("Size:         %dx%d\n", b.Dx(), b.Dy())
+	fmt.Printf("Frames:       %d\n", len(anim.frames))
+	fmt.Printf("Colors:       %d\n", len(colors))
+	fmt.Printf("Transparency: %v\n", transparent)
+	fmt.Printf("Stud size:    %dpx\n", cellSize)
+	fmt.Printf("Stud grid:    %dx%d\n", gw, gh)
+	fmt.Printf("System:       %s\n", quant.System.Name)
+	fmt.Printf("Layers:       %d\n", len(quant.Layers))
+	var bricks int
+	for _, layer := range quant.Layers {
+		bricks += len(layer)
+	}
+	fmt.Printf("Bricks:       %d\n", bricks)
+	fmt.Printf("Colors used:  %d\n", len(quant.Used))
+	for _, c := range quant.Used {
+		fmt.Printf("  %v\n", pal.Name(c))
+	}
+	return exitOK
+}
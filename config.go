@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configFlags are the flags which are not part of a configuration file.
+var configFlags = map[string]bool{"config": true, "save-config": true}
+
+// commandKey is the configuration key holding the name of the command which saved the file.
+const commandKey = "command"
+
+// parseArgs parses the command-line arguments, then loads the configuration file, if any,
+// the options set on the command line overriding the file values. Finally it saves the effective configuration, if requested.
+func parseArgs(fs *flag.FlagSet, s *settings, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *s.config != "" {
+		values, err := loadConfig(*s.config)
+		if err != nil {
+			return fmt.Errorf("failed to load the configuration '%v': %v", *s.config, err)
+		}
+		explicit := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) {
+			explicit[f.Name] = true
+		})
+		command := values[commandKey]
+		delete(values, commandKey)
+		for name, value := range values {
+			if configFlags[name] || !commandOption(name) {
+				return fmt.Errorf("%v: unknown option '%v'", *s.config, name)
+			}
+			// The options of the other commands are ignored, so the same file can be used by all the commands.
+			if fs.Lookup(name) == nil || explicit[name] {
+				continue
+			}
+			// The command specific options apply only to the command which saved the file,
+			// since their meaning differs between commands, e.g. -out.
+			if command != "" && command != fs.Name() && !sharedOption(name) {
+				continue
+			}
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("%v: invalid value '%v' for option '%v'", *s.config, value, name)
+			}
+		}
+	}
+	if *s.saveConfig != "" {
+		if err := saveConfig(*s.saveConfig, fs); err != nil {
+			return fmt.Errorf("failed to save the configuration '%v': %v", *s.saveConfig, err)
+		}
+	}
+	return nil
+}
+
+// sharedOption checks if the option is one of the image processing options shared by all the commands.
+func sharedOption(name string) bool {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	newSettings(fs)
+	return fs.Lookup(name) != nil
+}
+
+// commandOption checks if the option is defined by any of the commands.
+func commandOption(name string) bool {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	newSettings(fs)
+	newRenderSettings(fs)
+	return fs.Lookup(name) != nil
+}
+
+// loadConfig loads the option values from a configuration file. The file format is detected from the file extension:
+// .json, .toml or .yaml (.yml). The options are flat, the keys being the command-line option names,
+// besides the optional "command" key naming the command the file was saved by.
+// Only the flat key/value subset of the TOML and YAML formats is supported.
+func loadConfig(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		return decodeJSONConfig(f)
+	case ".toml":
+		return decodeFlatConfig(f, "=")
+	case ".yaml", ".yml":
+		return decodeFlatConfig(f, ":")
+	default:
+		return nil, fmt.Errorf("unsupported configuration format: %s", ext)
+	}
+}
+
+// decodeJSONConfig decodes a JSON object holding the option values.
+func decodeJSONConfig(r io.Reader) (map[string]string, error) {
+	var object map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&object); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for k, v := range object {
+		switch v := v.(type) {
+		case string:
+			values[k] = v
+		case float64:
+			values[k] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			values[k] = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("option '%v': unsupported value %v", k, v)
+		}
+	}
+	return values, nil
+}
+
+// decodeFlatConfig decodes the "key <sep> value" lines of a flat TOML or YAML file.
+// The values are either quoted strings or bare scalars. The lines starting with # are comments.
+func decodeFlatConfig(r io.Reader, sep string) (map[string]string, error) {
+	var (
+		values  = make(map[string]string)
+		scanner = bufio.NewScanner(r)
+		line    int
+	)
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || text == "---" {
+			continue
+		}
+		parts := strings.SplitN(text, sep, 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: invalid option %q", line, text)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if value == "" {
+			return nil, fmt.Errorf("line %d: nested options are not supported", line)
+		}
+		if q := value[0]; q == '"' || q == '\'' {
+			end := closingQuote(value)
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: invalid string %v", line, value)
+			}
+			if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+				return nil, fmt.Errorf("line %d: invalid string %v", line, value)
+			}
+			value = value[:end+1]
+			if q == '"' {
+				v, err := strconv.Unquote(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid string %v", line, value)
+				}
+				value = v
+			} else {
+				value = value[1:end]
+			}
+		} else {
+			// Strip the trailing comment of a bare value.
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// closingQuote returns the index of the quote closing the string starting the value, or -1 if the string is not closed.
+// Backslash escapes are only recognized in double-quoted strings.
+func closingQuote(value string) int {
+	q := value[0]
+	for i := 1; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && q == '"':
+			i++
+		case value[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+// saveConfig writes the value of all the options into a configuration file, together with the command name.
+// The file format is detected from the file extension: .json, .toml or .yaml (.yml).
+func saveConfig(path string, fs *flag.FlagSet) error {
+	var (
+		names  []string
+		values = make(map[string]interface{})
+	)
+	fs.VisitAll(func(f *flag.Flag) {
+		if configFlags[f.Name] {
+			return
+		}
+		names = append(names, f.Name)
+		values[f.Name] = f.Value.(flag.Getter).Get()
+	})
+	names = append(names, commandKey)
+	values[commandKey] = fs.Name()
+	sort.Strings(names)
+
+	var encode func(io.Writer) error
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		encode = func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(values)
+		}
+	case ".toml":
+		encode = func(w io.Writer) error { return encodeFlatConfig(w, names, values, " = ") }
+	case ".yaml", ".yml":
+		encode = func(w io.Writer) error { return encodeFlatConfig(w, names, values, ": ") }
+	default:
+		return fmt.Errorf("unsupported configuration format: %s", ext)
+	}
+	return writeFile(path, encode)
+}
+
+// encodeFlatConfig writes the options as "key <sep> value" lines, the strings being quoted.
+func encodeFlatConfig(w io.Writer, names []string, values map[string]interface{}, sep string) error {
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		value := values[name]
+		if s, ok := value.(string); ok {
+			value = strconv.Quote(s)
+		}
+		fmt.Fprintf(bw, "%s%s%v\n", name, sep, value)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeFlatConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		sep   string
+		want  map[string]string
+		err   bool
+	}{
+		{"toml", "size = 20\ncolors = 8 # comment\nlogo = \"a # b\"\nwall = true\n", "=", map[string]string{"size": "20", "colors": "8", "logo": "a # b", "wall": "true"}, false},
+		{"toml literal", "key = '#00ff00'\n", "=", map[string]string{"key": "#00ff00"}, false},
+		{"toml escape", `logo = "say \"hi\""`, "=", map[string]string{"logo": `say "hi"`}, false},
+		{"yaml", "---\n# project\nsize: 20\npalette: \"system\" # fixed\n", ":", map[string]string{"size": "20", "palette": "system"}, false},
+		{"empty", "\n# only comments\n", "=", map[string]string{}, false},
+		{"missing separator", "size 20\n", "=", nil, true},
+		{"nested", "render:\n  size: 20\n", ":", nil, true},
+		{"unterminated string", "logo = \"abc\n", "=", nil, true},
+		{"trailing garbage", "logo = \"abc\" def\n", "=", nil, true},
+		{"bad escape", `logo = "\q"`, "=", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeFlatConfig(strings.NewReader(tt.input), tt.sep)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if !tt.err && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONConfig(t *testing.T) {
+	tests := []struct {
+		input string
+		want  map[string]string
+		err   bool
+	}{
+		{`{"size": 20, "noise": 2.5, "wall": true, "logo": "x"}`, map[string]string{"size": "20", "noise": "2.5", "wall": "true", "logo": "x"}, false},
+		{`{"size": [1, 2]}`, nil, true},
+		{`{"size": null}`, nil, true},
+		{`[1]`, nil, true},
+		{`{`, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := decodeJSONConfig(strings.NewReader(tt.input))
+		if (err != nil) != tt.err {
+			t.Errorf("%s: got error %v, want error %v", tt.input, err, tt.err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+// parseCommand parses the arguments of a command defining the -out option besides the image processing options.
+func parseCommand(name string, args ...string) (*flag.FlagSet, *settings, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	s := newSettings(fs)
+	if name == "render" {
+		newRenderSettings(fs)
+	} else {
+		fs.String("out", "", "")
+	}
+	return fs, s, parseArgs(fs, s, args)
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "legoizer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, ext := range []string{".json", ".toml", ".yaml"} {
+		t.Run(ext, func(t *testing.T) {
+			path := filepath.Join(dir, "project"+ext)
+			_, _, err := parseCommand("render", "-in", "a b.png", "-size", "12", "-logo", `"x"`, "-wall", "-out", "out.png", "-ldraw", "a.ldr", "-save-config", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The command-line options override the file values.
+			fs, s, err := parseCommand("render", "-config", path, "-size", "20")
+			if err != nil {
+				t.Fatal(err)
+			}
+			logo := fs.Lookup("logo").Value.String()
+			if *s.in != "a b.png" || *s.legoSize != 20 || logo != `"x"` || !*s.wall {
+				t.Errorf("got in %q, size %d, logo %q, wall %v", *s.in, *s.legoSize, logo, *s.wall)
+			}
+			if out := fs.Lookup("out").Value.String(); out != "out.png" {
+				t.Errorf("got out %q, want out.png", out)
+			}
+
+			// The options of the other commands are ignored, and so are the command specific options saved by another command.
+			fs, s, err = parseCommand("parts", "-config", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *s.in != "a b.png" || *s.legoSize != 12 {
+				t.Errorf("parts: got in %q, size %d", *s.in, *s.legoSize)
+			}
+			if out := fs.Lookup("out").Value.String(); out != "" {
+				t.Errorf("parts: got out %q, want it empty", out)
+			}
+		})
+	}
+}
+
+func TestConfigUnknownOption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "legoizer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "project.json")
+	if err := ioutil.WriteFile(path, []byte(`{"colour": 8}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := parseCommand("parts", "-config", path); err == nil {
+		t.Error("expected an error for an unknown option")
+	}
+}
+
+func TestParseArgsInvalid(t *testing.T) {
+	if _, _, err := parseCommand("render", "-size", "big"); err == nil {
+		t.Error("expected an error for an invalid option value")
+	}
+	if _, _, err := parseCommand("parts", "-unknown"); err == nil {
+		t.Error("expected an error for an unknown option")
+	}
+}
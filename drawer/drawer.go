@@ -5,68 +5,206 @@ import (
 	"image"
 	"image/color"
 	"math"
-	"math/rand"
-	"time"
 
 	proc "github.com/esimov/legoizer/processor"
 	"github.com/fogleman/gg"
-	"github.com/lucasb-eyer/go-colorful"
 )
 
-const (
-	_1x1 = iota
-	_2x1
-	_3x1
-	_4x1
-	_6x1
-	_2x2
-	_3x2
-	_4x2
-	_6x2
-)
-
-type point struct {
-	x, y float64
-}
-
-type lego struct {
-	point
-	cellSize  float64
-	cellColor color.NRGBA64
-}
-
 type context struct {
 	*gg.Context
+	logo     string
+	sampling Sampling
+	style    RenderStyle
+	wall     bool
 }
 
 type Quantizer struct {
 	proc.Quant
+	// Logo is the text embossed on top of each stud. Leave it empty to render plain studs.
+	Logo string
+	// Noise is the film-grain noise applied over the generated image.
+	Noise Noise
+	// Background, if set, removes the source image background before quantization.
+	Background *proc.ChromaKey
+	// Adjust is the image adjustment pipeline applied on the source image before quantization.
+	// The color replacing the removed background is not adjusted.
+	Adjust proc.Pipeline
+	// Sampling is the method used to compute the stud colors.
+	Sampling Sampling
+	// Overrides forces the color of individual studs, or leaves them empty.
+	Overrides []Override
+	// Remap substitutes the quantized palette colors before the bricks are placed.
+	Remap proc.Remap
+	// Remapped reports the palette colors replaced by the Remap rules during the last Process call.
+	Remapped []proc.Substitution
+	// Unmatched reports the Remap rules which matched no palette color during the last Process call.
+	Unmatched proc.Remap
+	// Used reports the palette colors of the last processed image.
+	Used color.Palette
+	// System is the brick system used to lay out and render the bricks. Defaults to the Standard bricks.
+	System *BrickSystem
+	// Relief, if set, stacks several layers of pieces on the studs following a height map.
+	Relief *Relief
+	// Wall lays out the bricks as a standing wall, each stud row being a course of bricks seen from the side.
+	// The relief is ignored in this mode.
+	Wall bool
+	// Bricks reports the bricks placed on the last processed image. In relief mode these are the bottom layer bricks.
+	Bricks []Brick
+	// Layers reports the brick layers of the last processed image, bottom first.
+	// Without a relief the bricks form a single layer. In wall mode each layer is a course of the wall.
+	Layers [][]Brick
+	// Seams reports the joints running through several courses of the last processed wall.
+	Seams []Seam
+	// Uncovered reports the non empty studs of the last processed image which no system shape fits in,
+	// e.g. the single studs of a system without a 1x1 shape. In relief mode these are the bottom layer studs.
+	Uncovered []image.Point
+	// Quiet disables the progress bar.
+	Quiet bool
+	// Temporal keeps the bricks of the previously processed frame lying on studs whose color did not change,
+	// so the layout of consecutive frames does not flicker. It applies to the flat, relief and wall layouts.
+	// Call Reset before processing an unrelated frame sequence.
+	Temporal bool
+
+	previous       *studGrid
+	previousLayers [][]Brick
+	// previousHeights are the relief heights of the previously processed frame.
+	previousHeights []int
 }
 
-type legoIndexes struct {
-	idx int
-	idy int
-}
-
-var legos []legoIndexes
+// threshold is the 16 bit channel value below which a stud color is considered dark.
+var threshold uint16 = 0x8000
 
-var (
-	threshold   uint16 = 127
-	legoMaxRows        = 3
-	legoMaxCols        = 2
-	idx, idy           = 1, 1
-)
+// prepare removes the background of the source image and applies the adjustments.
+// The adjustments run between the removal of the background and its replacement,
+// so the key matches the source colors and the replacement color is kept as it is.
+func (quant *Quantizer) prepare(img image.Image) image.Image {
+	if quant.Background == nil {
+		if len(quant.Adjust) > 0 {
+			return quant.Adjust.Apply(img)
+		}
+		return img
+	}
+	ck := *quant.Background
+	ck.Replace = nil
+	img = ck.Apply(img)
+	if len(quant.Adjust) > 0 {
+		img = quant.Adjust.Apply(img)
+	}
+	return quant.Background.Fill(img)
+}
 
 // Process is the main function responsible to generate the lego bricks based on the provided source image.
 func (quant *Quantizer) Process(input image.Image, nq int, cs int) image.Image {
-	rand.Seed(time.Now().UTC().Unix())
 	var (
-		legoType                 int
-		cellSize                 int
-		current, total, progress float64
+		progress float64
+		system   = quant.System
 	)
+	if system == nil {
+		system, _ = Standard.Allow("bricks")
+	}
 
 	dx, dy := input.Bounds().Dx(), input.Bounds().Dy()
+	cellSize, gw, gh := GridSize(input.Bounds(), cs)
+
+	input = quant.prepare(input)
+	quantified := quant.Quantize(input, nq)
+	quant.Remapped, quant.Unmatched = nil, nil
+	if pi, ok := quantified.(*image.Paletted); ok && len(quant.Remap) > 0 {
+		pi.Palette, quant.Remapped, quant.Unmatched = quant.Remap.Apply(pi.Palette)
+	}
+	quant.Used = opaquePalette(quantified)
+	nrgbaImg := convertToNRGBA64(quantified)
+	if len(quant.Overrides) > 0 {
+		quant.Used = applyOverrides(nrgbaImg, quant.Used, quant.Palette, quant.Overrides, cellSize)
+	}
+
+	dc := &context{gg.NewContext(dx, dy), quant.Logo, quant.Sampling, system.Style, quant.Wall}
+	// Keep the background transparent when the source image transparency is taken into account.
+	if quant.AlphaThreshold == 0 {
+		dc.SetRGB(1, 1, 1)
+		dc.Clear()
+	}
+	dc.SetRGB(0, 0, 0)
+
+	grid := newStudGrid(gw, gh)
+	for x := 0; x < grid.width; x++ {
+		for y := 0; y < grid.height; y++ {
+			cell := image.Rect(x*cellSize, y*cellSize, (x+1)*cellSize, (y+1)*cellSize)
+			// Leave the cell empty if the source image is transparent in that region.
+			if quant.AlphaThreshold > 0 && getAvgAlpha(input, cell) < quant.AlphaThreshold {
+				continue
+			}
+			// The sampled colors are snapped back to the quantized palette, since averaging the cell pixels mixes the palette colors.
+			grid.set(x, y, snapColor(quant.Used, dc.sampling.cellColor(nrgbaImg, cell)))
+		}
+	}
+	var (
+		previous [][]Brick
+		changed  []bool
+	)
+	if quant.Temporal {
+		previous, changed = quant.previousLayers, grid.changes(quant.previous)
+	}
+	quant.Seams = nil
+	switch {
+	case quant.Wall:
+		quant.Layers, quant.Seams = grid.wall(system.shapes(), previous, changed)
+	case quant.Relief != nil && quant.Relief.Layers > 1:
+		heights := quant.Relief.heights(grid, input, cellSize)
+		if quant.Temporal {
+			// The studs whose height changed are rebuilt, like the studs whose color changed.
+			changed = heightChanges(changed, heights, quant.previousHeights)
+			quant.previousHeights = heights
+		}
+		quant.Layers = grid.stack(heights, quant.Relief.Layers, system.shapes(), previous, changed)
+	default:
+		var keep []Brick
+		if len(previous) > 0 {
+			keep = grid.keep(previous[0], changed)
+		}
+		quant.Layers = [][]Brick{grid.layout(system.shapes(), false, keep)}
+	}
+	if quant.Temporal {
+		quant.previous, quant.previousLayers = grid, quant.Layers
+	}
+	quant.Bricks = nil
+	if quant.Wall {
+		for _, course := range quant.Layers {
+			quant.Bricks = append(quant.Bricks, course...)
+		}
+	} else if len(quant.Layers) > 0 {
+		quant.Bricks = quant.Layers[0]
+	}
+	quant.Uncovered = grid.uncovered(quant.Bricks)
+
+	total := float64(len(quant.Bricks))
+	for i, b := range quant.Bricks {
+		dc.generateLegoSet(b, float64(cellSize))
+
+		if p := math.Floor(float64(i+1) / total * 100.0); p > progress && !quant.Quiet {
+			progress = p
+			showProgress(progress)
+		}
+	}
+	// Trace the brick borders once all the bricks are in place, so the neighboring bricks do not cover them.
+	if system.Style != StyleBead {
+		for _, b := range quant.Bricks {
+			dc.drawBrickBorders(b, float64(cellSize))
+		}
+	}
+	if progress < 100 && !quant.Quiet {
+		showProgress(100)
+	}
+	img := dc.Image().(*image.RGBA)
+
+	return noise(quant.Noise, img)
+}
+
+// GridSize returns the stud size in pixels and the stud grid dimensions of an image.
+// The stud size is derived from the image size when cs is 0.
+// A cell is part of the grid only if its center is inside the image.
+func GridSize(bounds image.Rectangle, cs int) (cellSize, width, height int) {
+	dx, dy := bounds.Dx(), bounds.Dy()
 	imgRatio := func(w, h int) float64 {
 		var ratio float64
 		if w > h {
@@ -82,76 +220,24 @@ func (quant *Quantizer) Process(input image.Image, nq int, cs int) image.Image {
 	} else {
 		cellSize = cs
 	}
-	quantified := quant.Quantize(input, nq)
-	nrgbaImg := convertToNRGBA64(quantified)
-
-	dc := &context{gg.NewContext(dx, dy)}
-	dc.SetRGB(1, 1, 1)
-	dc.Clear()
-	dc.SetRGB(0, 0, 0)
-
-	total = math.Floor(float64(dx * dy / (cellSize * cellSize)))
-	for x := 0; x < dx; x += cellSize {
-		// Reset Y index after each row
-		idy = 1
-		for y := 0; y < dy; y += cellSize {
-			xx := x + (cellSize / 2)
-			yy := y + (cellSize / 2)
-			current = math.Floor(float64(idx * dy / cellSize))
-
-			if xx < dx && yy < dy {
-				subImg := nrgbaImg.SubImage(image.Rect(x, y, x+cellSize, y+cellSize)).(*image.NRGBA64)
-				cellColor := getAvgColor(subImg)
-
-				lego := dc.getCurrentLego(nrgbaImg, float64(x), float64(y), float64(cellSize))
-				rows, cols := dc.checkNeighbors(lego, nrgbaImg)
-
-				switch {
-				case rows == 1 && cols == 1:
-					legoType = _1x1
-				case rows == 2 && cols == 1:
-					legoType = _2x1
-				case rows == 3 && cols == 1:
-					legoType = _3x1
-				case rows == 4 && cols == 1:
-					legoType = _4x1
-				case rows == 6 && cols == 1:
-					legoType = _6x1
-				case rows == 2 && cols == 2:
-					legoType = _2x2
-				case rows == 3 && cols == 2:
-					legoType = _3x2
-				case rows == 4 && cols == 2:
-					legoType = _4x2
-				case rows == 6 && cols == 2:
-					legoType = _6x2
-				}
-				dc.generateLegoSet(float64(x), float64(y), float64(xx), float64(yy), float64(cellSize), idx, idy, cellColor, legoType)
-			}
-			idy++
-		}
-		if current < total {
-			progress = math.Floor(float64(current/total) * 100.0)
-			showProgress(progress)
-		}
-		idx++
-	}
-	if progress < 100 {
-		showProgress(100)
+	if cellSize < 1 {
+		cellSize = 1
 	}
-	img := dc.Image()
-	noisyImg := noise(10, img, img.Bounds().Dx(), img.Bounds().Dy())
-
-	return noisyImg
+	return cellSize, (dx - cellSize/2 + cellSize - 1) / cellSize, (dy - cellSize/2 + cellSize - 1) / cellSize
 }
 
 // createLegoPiece creates the lego piece
-func (dc *context) createLegoPiece(x, y, xx, yy, cellSize float64, c color.NRGBA64) *lego {
+func (dc *context) createLegoPiece(x, y, xx, yy, cellSize float64, c color.NRGBA64) {
+	if dc.style == StyleBead {
+		dc.createBead(xx, yy, cellSize, c)
+		return
+	}
 	// Brightness factor
 	var bf = 1.0005
 	// Background
-	dc.DrawRectangle(x, y, x+cellSize, y+cellSize)
-	dc.SetRGBA(float64(c.R/255^0xff)*bf, float64(c.G/255^0xff)*bf, float64(c.B/255^0xff)*bf, 1)
+	dc.DrawRectangle(x, y, cellSize, cellSize)
+	r, g, b := rgb(c)
+	dc.SetRGBA(math.Min(1, r*bf), math.Min(1, g*bf), math.Min(1, b*bf), 1)
 	dc.Fill()
 	// Create a shadow effect
 	dc.Push()
@@ -168,8 +254,7 @@ func (dc *context) createLegoPiece(x, y, xx, yy, cellSize float64, c color.NRGBA
 	grad = gg.NewRadialGradient(xx, yy, cellSize/2, x, y, 0)
 	grad.AddColorStop(0, color.RGBA{0, 0, 0, 177})
 
-	r, g, b := c.R/255^0xff, c.G/255^0xff, c.B/255^0xff
-	if r > threshold || g > threshold || b > threshold {
+	if isDark(c) {
 		grad.AddColorStop(1, color.RGBA{0, 0, 0, 255})
 	} else {
 		grad.AddColorStop(1, color.RGBA{177, 177, 177, 255})
@@ -183,227 +268,133 @@ func (dc *context) createLegoPiece(x, y, xx, yy, cellSize float64, c color.NRGBA
 
 	// Draw the main circle
 	dc.DrawCircle(xx, yy, float64(cellSize/2)-math.Sqrt(float64(cellSize)))
-	dc.SetRGBA(float64(c.R/255^0xff), float64(c.G/255^0xff), float64(c.B/255^0xff), float64(c.A/255))
+	dc.SetRGB(r, g, b)
 	dc.Fill()
 
-	return &lego{
-		point{x: x, y: y},
-		cellSize,
-		c,
+	// Hollow studs have a shaded hole in the middle
+	if dc.style == StyleHollowStud {
+		dc.DrawCircle(xx, yy, (cellSize/2-math.Sqrt(cellSize))*0.55)
+		dc.SetColor(color.RGBA{0, 0, 0, 77})
+		dc.Fill()
+		return
 	}
-}
 
-// generateLegoSet creates the lego block constituted by the lego pieces.
-// This function traces the lego borders on the intersection of columns and rows.
-func (dc *context) generateLegoSet(x, y, xx, yy, cellSize float64, idx, idy int, c color.NRGBA64, legoType int) *lego {
-	var rows, cols int
-	switch legoType {
-	case _1x1:
-		rows, cols = 1, 1
-	case _2x1:
-		rows, cols = 2, 1
-	case _3x1:
-		rows, cols = 3, 1
-	case _4x1:
-		rows, cols = 4, 1
-	case _6x1:
-		rows, cols = 6, 1
-	case _2x2:
-		rows, cols = 2, 2
-	case _3x2:
-		rows, cols = 3, 2
-	case _4x2:
-		rows, cols = 4, 2
-	case _6x2:
-		rows, cols = 6, 2
-	}
-
-	drawLeftBorderLine := func(x, y float64) {
-		dc.SetColor(color.RGBA{177, 177, 177, 177})
-		dc.SetLineWidth(0.10)
-		dc.MoveTo(x, y)
-		dc.LineTo(x, y+cellSize)
-		dc.ClosePath()
-		dc.Stroke()
-	}
-	drawTopBorderLine := func(x, y float64) {
-		dc.SetColor(color.RGBA{177, 177, 177, 177})
-		dc.SetLineWidth(0.05)
-		dc.MoveTo(x, y)
-		dc.LineTo(x+cellSize, y)
-		dc.ClosePath()
-		dc.Stroke()
-	}
-	drawRightBorderLine := func(x, y float64) {
-		dc.SetColor(color.RGBA{0, 0, 0, 177})
-		dc.SetLineWidth(0.15)
-		dc.MoveTo(x+cellSize, y)
-		dc.LineTo(x+cellSize, y+cellSize)
-		dc.ClosePath()
-		dc.Stroke()
-	}
-	drawBottomBorderLine := func(x, y float64) {
-		dc.SetColor(color.RGBA{0, 0, 0, 177})
-		dc.SetLineWidth(0.15)
-		dc.MoveTo(x, y+cellSize)
-		dc.LineTo(x+cellSize, y+cellSize)
-		dc.ClosePath()
-		dc.Stroke()
-	}
+	// Emboss the logo on the stud
+	dc.drawStudLogo(xx, yy, float64(cellSize/2)-math.Sqrt(float64(cellSize)), c)
+}
 
-	// Create the lego piece then trace the borders.
-	dc.createLegoPiece(x, y, float64(xx), float64(yy), float64(cellSize), c)
+// createBead creates a fuse bead: a ring with a hole in the middle.
+func (dc *context) createBead(xx, yy, cellSize float64, c color.NRGBA64) {
+	dc.DrawCircle(xx, yy, cellSize*0.48)
+	dc.SetRGB(rgb(c))
+	dc.Fill()
 
-	legoExists := findLegoIndex(legos, int(x), int(y))
-	// Draw the borders only if index does not exists in the index table.
-	if !legoExists {
-		if idx%rows == 0 {
-			drawLeftBorderLine(x-(cellSize*float64(rows))+cellSize+1, y)
-			drawRightBorderLine(x, y)
-		}
-		if idy%cols == 0 {
-			drawTopBorderLine(x, y-(cellSize*float64(cols))+cellSize+1)
-			drawBottomBorderLine(x, y)
-		}
-	}
+	// Highlight on the top-left side of the ring
+	grad := gg.NewRadialGradient(xx-cellSize/6, yy-cellSize/6, 0, xx, yy, cellSize*0.48)
+	grad.AddColorStop(0, color.RGBA{255, 255, 255, 77})
+	grad.AddColorStop(1, color.RGBA{0, 0, 0, 77})
+	dc.SetFillStyle(grad)
+	dc.DrawCircle(xx, yy, cellSize*0.48)
+	dc.Fill()
 
-	return &lego{
-		point{x: x, y: y},
-		cellSize,
-		c,
-	}
+	dc.DrawCircle(xx, yy, cellSize*0.18)
+	dc.SetColor(color.RGBA{0, 0, 0, 177})
+	dc.Fill()
 }
 
-// getCurrentLego returns the current lego's first pixel color.
-// We don't need to get all the colors of the cell, since we are averaging the cell color.
-func (dc *context) getCurrentLego(cell *image.NRGBA64, x, y, cellSize float64) *lego {
-	// Get the first pixel color
-	var c = cell.NRGBA64At(int(x), int(y))
-
-	return &lego{
-		point{x: x, y: y},
-		cellSize,
-		c,
+// generateLegoSet creates the lego block constituted by the lego pieces.
+func (dc *context) generateLegoSet(b Brick, cellSize float64) {
+	r := b.Bounds()
+	// The bricks of a standing wall show their side, without studs.
+	if dc.wall {
+		dc.DrawRectangle(float64(r.Min.X)*cellSize, float64(r.Min.Y)*cellSize, float64(r.Dx())*cellSize, float64(r.Dy())*cellSize)
+		dc.SetRGB(rgb(b.Color))
+		dc.Fill()
+		return
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			px, py := float64(x)*cellSize, float64(y)*cellSize
+			dc.createLegoPiece(px, py, px+math.Floor(cellSize/2), py+math.Floor(cellSize/2), cellSize, b.Color)
+		}
 	}
 }
 
-// Check if the current lego color is identical with the neighbors color.
-// Returns the number of rows and columns identical with the current lego, with the rows & columns representing the lego type.
-func (dc *context) checkNeighbors(lego *lego, neighborCell *image.NRGBA64) (int, int) {
-	var lastIdx, lastIdy int = 1, 1
+// drawBrickBorders traces the borders of the brick.
+// The top and left borders are highlighted, while the bottom and right borders are shaded.
+func (dc *context) drawBrickBorders(b Brick, cellSize float64) {
 	var (
-		cellSize            = lego.cellSize
-		cellColor           = lego.cellColor
-		x                   = lego.x
-		y                   = lego.y
-		ct                  = 7.0
-		currentRowCellColor color.NRGBA64
+		r  = b.Bounds()
+		x0 = float64(r.Min.X) * cellSize
+		y0 = float64(r.Min.Y) * cellSize
+		x1 = float64(r.Max.X) * cellSize
+		y1 = float64(r.Max.Y) * cellSize
 	)
-
-	rows, cols := 1, 1
-	legoWidth := random(rows, legoMaxRows)
-	legoHeight := random(cols, legoMaxCols)
-
-	xi := int(x)
-	yi := int(y)
-
-	// Rows
-	for i := 1; ; i++ {
-		if i > legoWidth {
-			break
-		}
-		if xi*i < dc.Width() && yi*i < dc.Height() {
-			nextCell := neighborCell.SubImage(image.Rect(xi*i, yi, xi*i+int(cellSize), yi+int(cellSize))).(*image.NRGBA64)
-			nextCellColor := getAvgColor(nextCell)
-
-			// Because the next cell average color might differ from the current cell color even with a small amount,
-			// we have to check if the current cell color is approximately identical with the neighboring cells.
-			c1 := colorful.Color{
-				R: float64(cellColor.R >> 8),
-				G: float64(cellColor.G >> 8),
-				B: float64(cellColor.B >> 8),
-			}
-			c2 := colorful.Color{
-				R: float64(nextCellColor.R >> 8),
-				G: float64(nextCellColor.G >> 8),
-				B: float64(nextCellColor.B >> 8),
-			}
-
-			colorThreshold := c1.DistanceCIE94(c2)
-			if colorThreshold > ct {
-				currentRowCellColor = cellColor
-				lastIdx = xi * i
-				break
-			}
-		}
-		rows++
-	}
-
-	// Columns
-	for i := 1; ; i++ {
-		if i > legoHeight {
-			break
-		}
-		if xi*i < dc.Width() && yi*i < dc.Height() {
-			nextCell := neighborCell.SubImage(image.Rect(xi, yi*i, xi+int(cellSize), yi*i+int(cellSize))).(*image.NRGBA64)
-			nextCellColor := getAvgColor(nextCell)
-
-			c1 := colorful.Color{
-				R: float64(cellColor.R >> 8),
-				G: float64(cellColor.G >> 8),
-				B: float64(cellColor.B >> 8),
-			}
-			c2 := colorful.Color{
-				R: float64(nextCellColor.R >> 8),
-				G: float64(nextCellColor.G >> 8),
-				B: float64(nextCellColor.B >> 8),
-			}
-
-			colorThreshold := c1.DistanceCIE94(c2)
-			if colorThreshold > ct || currentRowCellColor.R != cellColor.R {
-				lastIdy = yi * i
-				break
-			}
-		}
-		cols++
-	}
-	// No lego piece with 5 rows
-	if rows == 5 {
-		rows = 4
-	}
-	// Save the generated lego indexes into the index table.
-	// We need verify if the lego borders have been traced based on the index value.
-	if !findLegoIndex(legos, lastIdx, lastIdy) {
-		legos = append(legos, legoIndexes{lastIdx, lastIdy})
+	drawLine := func(x0, y0, x1, y1, width float64, c color.Color) {
+		dc.SetColor(c)
+		dc.SetLineWidth(width)
+		dc.MoveTo(x0, y0)
+		dc.LineTo(x1, y1)
+		dc.ClosePath()
+		dc.Stroke()
 	}
-
-	return rows, cols
+	// Left border
+	drawLine(x0+1, y0, x0+1, y1, 0.10, color.RGBA{177, 177, 177, 177})
+	// Top border
+	drawLine(x0, y0+1, x1, y0+1, 0.05, color.RGBA{177, 177, 177, 177})
+	// Right border
+	drawLine(x1, y0, x1, y1, 0.15, color.RGBA{0, 0, 0, 177})
+	// Bottom border
+	drawLine(x0, y1, x1, y1, 0.15, color.RGBA{0, 0, 0, 177})
 }
 
-// getAvgColor get the average color of a cell
+// getAvgColor get the average color of a cell.
+// The pixels are weighted by their alpha value, so the transparent pixels do not contribute to the cell color.
 func getAvgColor(img *image.NRGBA64) color.NRGBA64 {
 	var (
-		bounds  = img.Bounds()
-		r, g, b int
+		bounds     = img.Bounds()
+		r, g, b, a int
 	)
 
 	for x := bounds.Min.X; x < bounds.Max.X; x++ {
 		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 			var c = img.NRGBA64At(x, y)
-			r += int(c.R)
-			g += int(c.G)
-			b += int(c.B)
+			r += int(c.R) * int(c.A)
+			g += int(c.G) * int(c.A)
+			b += int(c.B) * int(c.A)
+			a += int(c.A)
 		}
 	}
+	if a == 0 {
+		return color.NRGBA64{}
+	}
 
 	return color.NRGBA64{
-		R: maxUint16(0, minUint16(65535, uint16(r/(bounds.Dx()*bounds.Dy())))),
-		G: maxUint16(0, minUint16(65535, uint16(g/(bounds.Dx()*bounds.Dy())))),
-		B: maxUint16(0, minUint16(65535, uint16(b/(bounds.Dx()*bounds.Dy())))),
+		R: maxUint16(0, minUint16(65535, uint16(r/a))),
+		G: maxUint16(0, minUint16(65535, uint16(g/a))),
+		B: maxUint16(0, minUint16(65535, uint16(b/a))),
 		A: 255,
 	}
 }
 
+// getAvgAlpha get the average 8 bit alpha value of the source image region.
+func getAvgAlpha(img image.Image, rect image.Rectangle) uint8 {
+	var (
+		bounds = rect.Intersect(img.Bounds())
+		sum    int
+	)
+	if bounds.Empty() {
+		return 0
+	}
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			_, _, _, a := img.At(x, y).RGBA()
+			sum += int(a >> 8)
+		}
+	}
+	return uint8(sum / (bounds.Dx() * bounds.Dy()))
+}
+
 // convertToNRGBA64 converts an image.Image into an image.NRGBA64.
 func convertToNRGBA64(img image.Image) *image.NRGBA64 {
 	var (
@@ -418,15 +409,44 @@ func convertToNRGBA64(img image.Image) *image.NRGBA64 {
 	return nrgba
 }
 
-// findLegoIndex check if the processed lego index exists in the lego table.
-func findLegoIndex(legos []legoIndexes, ix, iy int) bool {
-	for i := 0; i < len(legos); i++ {
-		idx, idy := legos[i].idx, legos[i].idy
-		if idx == ix && idy == iy {
-			return true
+// opaquePalette returns the opaque colors of the paletted image palette.
+func opaquePalette(img image.Image) color.Palette {
+	pi, ok := img.(*image.Paletted)
+	if !ok {
+		return nil
+	}
+	var palette color.Palette
+	for _, c := range pi.Palette {
+		if _, _, _, a := c.RGBA(); a == 0xffff {
+			palette = append(palette, c)
 		}
 	}
-	return false
+	return palette
+}
+
+// rgb returns the normalized color components of the stud color.
+func rgb(c color.NRGBA64) (float64, float64, float64) {
+	return float64(c.R) / 0xffff, float64(c.G) / 0xffff, float64(c.B) / 0xffff
+}
+
+// nrgba returns the stud color as an opaque 8 bit color.
+func nrgba(c color.NRGBA64) color.NRGBA {
+	return color.NRGBA{R: uint8(c.R >> 8), G: uint8(c.G >> 8), B: uint8(c.B >> 8), A: 0xff}
+}
+
+// snapColor returns the palette color closest to the stud color. The empty studs are left as they are.
+func snapColor(p color.Palette, c color.NRGBA64) color.NRGBA64 {
+	if len(p) == 0 || c.A == 0 {
+		return c
+	}
+	sc := color.NRGBA64Model.Convert(p.Convert(color.NRGBA64{R: c.R, G: c.G, B: c.B, A: 0xffff})).(color.NRGBA64)
+	sc.A = c.A
+	return sc
+}
+
+// isDark checks if any of the stud color channels is dark.
+func isDark(c color.NRGBA64) bool {
+	return c.R < threshold || c.G < threshold || c.B < threshold
 }
 
 // round number down.
@@ -434,11 +454,6 @@ func round(x float64) float64 {
 	return math.Floor(x)
 }
 
-// random generates a random number between min & max.
-func random(min, max int) int {
-	return rand.Intn(max-min) + min
-}
-
 // minUint16 returns the smallest number between two uint16 numbers.
 func minUint16(x, y uint16) uint16 {
 	if x < y {
@@ -0,0 +1,63 @@
+package drawer
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	proc "github.com/esimov/legoizer/processor"
+)
+
+func TestPrepareKeepsBackgroundColor(t *testing.T) {
+	var (
+		white = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+		gray  = color.NRGBA{R: 0x80, G: 0x80, B: 0x80, A: 0xff}
+		bg    = color.NRGBA{R: 0x40, G: 0x60, B: 0x80, A: 0xff}
+	)
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			img.SetNRGBA(x, y, white)
+		}
+	}
+	img.SetNRGBA(1, 1, gray)
+
+	quant := Quantizer{
+		Background: &proc.ChromaKey{Key: white, FloodFill: true, Replace: bg},
+		Adjust:     proc.Pipeline{proc.Brightness(0.25)},
+	}
+	prepared := quant.prepare(img)
+	if got := color.NRGBAModel.Convert(prepared.At(0, 0)); got != bg {
+		t.Errorf("got background %v, want the unadjusted replacement color %v", got, bg)
+	}
+	if got := color.NRGBAModel.Convert(prepared.At(1, 1)).(color.NRGBA); got.R <= gray.R {
+		t.Errorf("got foreground %v, want it brightened", got)
+	}
+}
+
+func TestTransparentCellsStayEmpty(t *testing.T) {
+	// The right half of the image is transparent, so the bricks drawn too large would spill over it.
+	img := gradient(80, 40)
+	for y := 0; y < 40; y++ {
+		for x := 40; x < 80; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{})
+		}
+	}
+	quant := Quantizer{Quiet: true}
+	quant.AlphaThreshold = 0x80
+	dst := quant.Process(img, 8, 8)
+
+	for _, b := range quant.Bricks {
+		if b.Bounds().Max.X > 5 {
+			t.Errorf("brick at %d,%d on a transparent cell", b.X, b.Y)
+		}
+	}
+	// The antialiased outline of the neighbouring bricks can bleed into the first pixel column.
+	for y := 0; y < 40; y++ {
+		for x := 41; x < 80; x++ {
+			if _, _, _, a := dst.At(x, y).RGBA(); a != 0 {
+				t.Fatalf("pixel %d,%d of a transparent cell is not transparent", x, y)
+			}
+		}
+	}
+}
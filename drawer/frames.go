@@ -0,0 +1,102 @@
+package drawer
+
+import (
+	"image"
+	"image/draw"
+)
+
+// SharePalette computes a single palette of at most nq colors for all the frames of an animation,
+// so the same source colors are rendered with the same brick colors on every frame.
+// The palette replaces the fixed palette used by Process, the colors being chosen from the fixed palette if one is set.
+func (quant *Quantizer) SharePalette(frames []image.Image, nq int) {
+	// Prepare the frames the same way as in Process.
+	prepared := make([]image.Image, len(frames))
+	for i, f := range frames {
+		prepared[i] = quant.prepare(f)
+	}
+	montage := Montage(prepared)
+	// The weight map is defined over a single frame.
+	q := quant.Quant
+	q.Weights = nil
+	if len(q.Palette) > 0 {
+		quant.Palette = q.SelectPalette(montage, nq)
+		return
+	}
+	quant.Palette = opaquePalette(q.Quantize(montage, nq))
+}
+
+// Montage stacks the frames vertically into a single image, as wide as the widest frame.
+// Each frame is drawn at the left edge, right below the previous frame.
+func Montage(frames []image.Image) *image.NRGBA {
+	var bounds image.Rectangle
+	for _, f := range frames {
+		b := f.Bounds()
+		bounds.Max.X = maxInt(bounds.Max.X, b.Dx())
+		bounds.Max.Y += b.Dy()
+	}
+	montage := image.NewNRGBA(bounds)
+	y := 0
+	for _, f := range frames {
+		b := f.Bounds()
+		draw.Draw(montage, image.Rect(0, y, b.Dx(), y+b.Dy()), f, b.Min, draw.Src)
+		y += b.Dy()
+	}
+	return montage
+}
+
+// Reset clears the state kept from the previously processed frame.
+func (quant *Quantizer) Reset() {
+	quant.previous = nil
+	quant.previousLayers = nil
+	quant.previousHeights = nil
+}
+
+// changes returns the studs whose color changed since the previous frame.
+// All the studs are changed if there is no previous frame of the same size.
+func (g *studGrid) changes(previous *studGrid) []bool {
+	changed := make([]bool, len(g.cells))
+	for i, c := range g.cells {
+		changed[i] = previous == nil || previous.width != g.width || previous.height != g.height ||
+			c.A != previous.cells[i].A || !sameColor(c, previous.cells[i])
+	}
+	return changed
+}
+
+// heightChanges marks the studs whose relief height changed since the previous frame as changed.
+// All the studs are changed if there are no previous heights for the same grid.
+func heightChanges(changed []bool, heights, previous []int) []bool {
+	for i := range changed {
+		changed[i] = changed[i] || len(previous) != len(heights) || heights[i] != previous[i]
+	}
+	return changed
+}
+
+// keep returns the bricks lying only on unchanged non empty studs, their color being updated to the current frame.
+func (g *studGrid) keep(bricks []Brick, changed []bool) []Brick {
+	var kept []Brick
+next:
+	for _, b := range bricks {
+		r := b.Bounds()
+		if r.Max.X > g.width || r.Max.Y > g.height {
+			continue
+		}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if changed[y*g.width+x] || g.empty(x, y) {
+					continue next
+				}
+			}
+		}
+		b.Color = g.at(b.X, b.Y)
+		kept = append(kept, b)
+	}
+	return kept
+}
+
+// maxInt returns the biggest number between two integers.
+func maxInt(x, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
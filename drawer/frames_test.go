@@ -0,0 +1,79 @@
+package drawer
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestTemporalKeepsUnchangedBricks(t *testing.T) {
+	system, err := Standard.Allow("bricks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layouts := []struct {
+		name   string
+		layout func(g *studGrid, previous [][]Brick, changed []bool) [][]Brick
+	}{
+		{"flat", func(g *studGrid, previous [][]Brick, changed []bool) [][]Brick {
+			var keep []Brick
+			if len(previous) > 0 {
+				keep = g.keep(previous[0], changed)
+			}
+			return [][]Brick{g.layout(system.shapes(), false, keep)}
+		}},
+		{"wall", func(g *studGrid, previous [][]Brick, changed []bool) [][]Brick {
+			courses, _ := g.wall(system.shapes(), previous, changed)
+			return courses
+		}},
+	}
+	for _, tt := range layouts {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := stripes(23, 17)
+			first := tt.layout(prev, nil, nil)
+
+			// The changed stud also changes the staggering of the courses above it in a fresh wall layout.
+			g, stud := stripes(23, 17), image.Pt(0, 2)
+			g.set(stud.X, stud.Y, color.NRGBA64{R: 0x8000, A: 255})
+			changed := g.changes(prev)
+			second := tt.layout(g, first, changed)
+
+			var bricks []Brick
+			for _, layer := range second {
+				bricks = append(bricks, layer...)
+			}
+			checkCoverage(t, g, bricks)
+
+			placed := make(map[Brick]bool)
+			for _, b := range bricks {
+				placed[b] = true
+			}
+			for _, layer := range first {
+				for _, b := range layer {
+					if !stud.In(b.Bounds()) && !placed[b] {
+						t.Errorf("the brick %v on unchanged studs was not kept", b)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHeightChanges(t *testing.T) {
+	tests := []struct {
+		changed  []bool
+		heights  []int
+		previous []int
+		want     []bool
+	}{
+		{[]bool{false, true, false}, []int{1, 2, 3}, []int{1, 2, 2}, []bool{false, true, true}},
+		{[]bool{false, false}, []int{1, 2}, nil, []bool{true, true}},
+		{[]bool{false, false}, []int{1, 2}, []int{1, 2}, []bool{false, false}},
+	}
+	for _, tt := range tests {
+		if got := heightChanges(tt.changed, tt.heights, tt.previous); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("heights %v over %v: got %v, want %v", tt.heights, tt.previous, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package drawer
+
+import (
+	"image"
+	"image/color"
+	"sort"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// colorTolerance is the maximum CIE94 distance between two studs considered of the same color.
+const colorTolerance = 0.02
+
+// Brick is a piece placed on the stud grid.
+type Brick struct {
+	// X and Y are the stud coordinates of the brick top-left corner.
+	X, Y  int
+	Shape Shape
+	// Rotated marks the bricks turned by 90 degrees, the shape width being laid out vertically.
+	Rotated bool
+	Color   color.NRGBA64
+}
+
+// placement is a shape with a given orientation.
+type placement struct {
+	shape   Shape
+	rotated bool
+}
+
+// studGrid holds the color of each stud. The empty studs have a zero alpha value.
+type studGrid struct {
+	width, height int
+	cells         []color.NRGBA64
+}
+
+// newStudGrid creates an empty stud grid.
+func newStudGrid(width, height int) *studGrid {
+	return &studGrid{
+		width:  width,
+		height: height,
+		cells:  make([]color.NRGBA64, width*height),
+	}
+}
+
+// at returns the color of the stud.
+func (g *studGrid) at(x, y int) color.NRGBA64 {
+	return g.cells[y*g.width+x]
+}
+
+// set sets the color of the stud.
+func (g *studGrid) set(x, y int, c color.NRGBA64) {
+	g.cells[y*g.width+x] = c
+}
+
+// empty checks if the stud has no brick.
+func (g *studGrid) empty(x, y int) bool {
+	return g.at(x, y).A == 0
+}
+
+// layout covers the non empty studs with bricks. The grid is scanned row by row,
+// placing on each uncovered stud the largest shape, in either orientation, which covers only uncovered studs
+// of the same color. The shapes are expected to be ordered by priority, the horizontal orientation being tried first,
+// unless vertical is set. The studs no shape fits in, e.g. the single studs without a 1x1 shape, are left uncovered.
+// The kept bricks are placed first, as they are. The bricks are returned in row major order.
+func (g *studGrid) layout(shapes []Shape, vertical bool, keep []Brick) []Brick {
+	var (
+		bricks     []Brick
+		covered    = make([]bool, len(g.cells))
+		placements []placement
+	)
+	for _, b := range keep {
+		r := b.Bounds()
+		for j := r.Min.Y; j < r.Max.Y; j++ {
+			for i := r.Min.X; i < r.Max.X; i++ {
+				covered[j*g.width+i] = true
+			}
+		}
+		bricks = append(bricks, b)
+	}
+	for _, s := range shapes {
+		if s.Width == s.Height {
+			placements = append(placements, placement{s, false})
+			continue
+		}
+		placements = append(placements, placement{s, vertical}, placement{s, !vertical})
+	}
+	fits := func(x, y int, p placement, c color.NRGBA64) bool {
+		w, h := p.size()
+		if x+w > g.width || y+h > g.height {
+			return false
+		}
+		for j := y; j < y+h; j++ {
+			for i := x; i < x+w; i++ {
+				if covered[j*g.width+i] || g.empty(i, j) || !sameColor(g.at(i, j), c) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	for y := 0; y < g.height; y++ {
+		for x := 0; x < g.width; x++ {
+			if covered[y*g.width+x] || g.empty(x, y) {
+				continue
+			}
+			var (
+				c     = g.at(x, y)
+				best  placement
+				found bool
+			)
+			for _, p := range placements {
+				if fits(x, y, p, c) {
+					best, found = p, true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+			w, h := best.size()
+			for j := y; j < y+h; j++ {
+				for i := x; i < x+w; i++ {
+					covered[j*g.width+i] = true
+				}
+			}
+			bricks = append(bricks, Brick{X: x, Y: y, Shape: best.shape, Rotated: best.rotated, Color: c})
+		}
+	}
+	if len(keep) > 0 {
+		sort.SliceStable(bricks, func(i, j int) bool {
+			if bricks[i].Y != bricks[j].Y {
+				return bricks[i].Y < bricks[j].Y
+			}
+			return bricks[i].X < bricks[j].X
+		})
+	}
+	return bricks
+}
+
+// uncovered returns the non empty studs which are not covered by the bricks, in row major order.
+func (g *studGrid) uncovered(bricks []Brick) []image.Point {
+	covered := make([]bool, len(g.cells))
+	for _, b := range bricks {
+		r := b.Bounds().Intersect(image.Rect(0, 0, g.width, g.height))
+		for j := r.Min.Y; j < r.Max.Y; j++ {
+			for i := r.Min.X; i < r.Max.X; i++ {
+				covered[j*g.width+i] = true
+			}
+		}
+	}
+	var studs []image.Point
+	for y := 0; y < g.height; y++ {
+		for x := 0; x < g.width; x++ {
+			if !covered[y*g.width+x] && !g.empty(x, y) {
+				studs = append(studs, image.Pt(x, y))
+			}
+		}
+	}
+	return studs
+}
+
+// Size returns the brick footprint width and height in studs, taking into account the brick orientation.
+func (b Brick) Size() (int, int) {
+	return placement{b.Shape, b.Rotated}.size()
+}
+
+// Bounds returns the brick footprint in stud units.
+func (b Brick) Bounds() image.Rectangle {
+	w, h := b.Size()
+	return image.Rect(b.X, b.Y, b.X+w, b.Y+h)
+}
+
+// size returns the footprint width and height of the oriented shape.
+func (p placement) size() (int, int) {
+	if p.rotated {
+		return p.shape.Height, p.shape.Width
+	}
+	return p.shape.Width, p.shape.Height
+}
+
+// sameColor checks if two stud colors are perceptually identical.
+func sameColor(c1, c2 color.NRGBA64) bool {
+	if c1 == c2 {
+		return true
+	}
+	cc1 := colorful.Color{R: float64(c1.R) / 0xffff, G: float64(c1.G) / 0xffff, B: float64(c1.B) / 0xffff}
+	cc2 := colorful.Color{R: float64(c2.R) / 0xffff, G: float64(c2.G) / 0xffff, B: float64(c2.B) / 0xffff}
+	return cc1.DistanceCIE94(cc2) <= colorTolerance
+}
@@ -0,0 +1,136 @@
+package drawer
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		system *BrickSystem
+		shapes []string
+		valid  bool
+	}{
+		{Standard, []string{"bricks"}, true},
+		{Standard, []string{"plates"}, true},
+		{Standard, []string{"2x4", "1x1"}, true},
+		// The single studs are left uncovered without a 1x1 shape.
+		{Standard, []string{"2x4", "2x2"}, true},
+		{Nanoblock, []string{"all"}, true},
+		{Beads, []string{"all"}, true},
+		{Duplo, []string{"all"}, true},
+		{Duplo, []string{"1x1"}, false},
+	}
+	for _, tt := range tests {
+		_, err := tt.system.Allow(tt.shapes...)
+		if valid := err == nil; valid != tt.valid {
+			t.Errorf("%s %v: got valid %v, want %v (%v)", tt.system.Name, tt.shapes, valid, tt.valid, err)
+		}
+	}
+	if err := (&BrickSystem{Name: "test", Shapes: []Shape{{Name: "1x1", Width: 1, Height: 1}}}).Validate(); err == nil {
+		t.Error("expected an error for a shape without part")
+	}
+}
+
+// stripes returns a stud grid of vertical color stripes of various widths, with an empty stud.
+func stripes(width, height int) *studGrid {
+	colors := []color.NRGBA64{
+		{R: 0xffff, A: 255},
+		{G: 0xffff, A: 255},
+		{B: 0xffff, A: 255},
+	}
+	g := newStudGrid(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			g.set(x, y, colors[(x*x/3+y/5)%len(colors)])
+		}
+	}
+	g.set(width/2, height/2, color.NRGBA64{})
+	return g
+}
+
+func TestLayoutCoversStuds(t *testing.T) {
+	tests := []struct {
+		name     string
+		system   *BrickSystem
+		shapes   []string
+		vertical bool
+		wall     bool
+	}{
+		{"bricks", Standard, []string{"bricks"}, false, false},
+		{"bricks vertical", Standard, []string{"bricks"}, true, false},
+		{"plates", Standard, []string{"plates"}, false, false},
+		{"nanoblock", Nanoblock, []string{"all"}, false, false},
+		{"beads", Beads, []string{"all"}, false, false},
+		{"wall", Standard, []string{"bricks"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			system, err := tt.system.Allow(tt.shapes...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := stripes(23, 17)
+			var bricks []Brick
+			if tt.wall {
+				courses, _ := g.wall(system.shapes(), nil, nil)
+				for _, c := range courses {
+					bricks = append(bricks, c...)
+				}
+			} else {
+				bricks = g.layout(system.shapes(), tt.vertical, nil)
+			}
+			checkCoverage(t, g, bricks)
+		})
+	}
+}
+
+// checkCoverage checks that the bricks cover every non empty stud exactly once, with the stud color.
+func checkCoverage(t *testing.T, g *studGrid, bricks []Brick) {
+	t.Helper()
+	covered := make([]int, len(g.cells))
+	for _, b := range bricks {
+		if b.Shape.Part == "" {
+			t.Errorf("brick at %d,%d: %s shape without part", b.X, b.Y, b.Shape)
+		}
+		r := b.Bounds()
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				covered[y*g.width+x]++
+				if g.at(x, y) != b.Color {
+					t.Errorf("brick at %d,%d covers the stud %d,%d of another color", b.X, b.Y, x, y)
+				}
+			}
+		}
+	}
+	for i, n := range covered {
+		if empty := g.cells[i].A == 0; (empty && n != 0) || (!empty && n != 1) {
+			t.Errorf("stud %d,%d covered %d times", i%g.width, i/g.width, n)
+		}
+	}
+}
+
+func TestLayoutUncovered(t *testing.T) {
+	red, blue := color.NRGBA64{R: 0xffff, A: 255}, color.NRGBA64{B: 0xffff, A: 255}
+	g := newStudGrid(4, 3)
+	for y := 0; y < g.height; y++ {
+		for x := 0; x < g.width; x++ {
+			g.set(x, y, red)
+		}
+	}
+	g.set(1, 0, blue)
+	g.set(3, 2, color.NRGBA64{})
+
+	// Without a 1x1 shape, the single blue stud and the red studs left over by the larger DUPLO bricks are uncovered.
+	bricks := g.layout(Duplo.shapes(), false, nil)
+	uncovered := g.uncovered(bricks)
+	if want := []image.Point{{1, 0}, {0, 2}, {2, 2}}; !reflect.DeepEqual(uncovered, want) {
+		t.Errorf("got uncovered studs %v, want %v", uncovered, want)
+	}
+	for _, p := range uncovered {
+		g.set(p.X, p.Y, color.NRGBA64{})
+	}
+	checkCoverage(t, g, bricks)
+}
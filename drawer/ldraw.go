@@ -0,0 +1,89 @@
+package drawer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/esimov/legoizer/palette"
+)
+
+// The LDraw dimensions of the standard brick system, in LDraw units.
+const (
+	ldrawStud  = 20
+	ldrawPlate = 8
+	ldrawBrick = 24
+)
+
+// WriteLDraw writes the brick layers as an LDraw model, bottom first, each layer being a separate building step.
+// The mosaic lies in the horizontal plane with the studs facing up, unless standing is set,
+// in which case each layer is a course of a standing wall. The colors are identified by the system palette IDs,
+// the palette colors without a numeric ID being written as LDraw direct colors. A color missing from the palette is an error.
+// The dimensions are scaled from the standard brick system according to the system pitch.
+// The systems whose shapes have no LDraw part, like the nanoblock and beads systems, are rejected.
+func WriteLDraw(w io.Writer, name string, layers [][]Brick, system *BrickSystem, standing bool) error {
+	if system == nil {
+		system = Standard
+	}
+	if !system.HasLDraw() {
+		return fmt.Errorf("the %s brick system has no LDraw parts", system.Name)
+	}
+	var (
+		bw     = bufio.NewWriter(w)
+		scale  = system.Pitch / Standard.Pitch
+		top    float64
+		height = ldrawBrick * scale
+	)
+	fmt.Fprintf(bw, "0 %s\n", name)
+	fmt.Fprintf(bw, "0 Name: %s\n", name)
+	fmt.Fprintf(bw, "0 Author: legoizer\n")
+
+	for k, bricks := range layers {
+		fmt.Fprintf(bw, "0 // Layer %d\n", k+1)
+		// The empty layers keep the height of the layer below.
+		for i, b := range bricks {
+			h := ldrawBrick * scale
+			if b.Shape.Plate {
+				h = ldrawPlate * scale
+			}
+			if i == 0 || h > height {
+				height = h
+			}
+		}
+		// The y axis points downwards and the part origin is the top of the part.
+		top -= height
+		for _, b := range bricks {
+			if b.Shape.LDraw == "" {
+				return fmt.Errorf("the %s shape at %d,%d has no LDraw part", b.Shape, b.X, b.Y)
+			}
+			dx, dy := b.Size()
+			x := (float64(b.X) + float64(dx)/2) * ldrawStud * scale
+			z := (float64(b.Y) + float64(dy)/2) * ldrawStud * scale
+			if standing {
+				z = float64(b.Shape.Height) / 2 * ldrawStud * scale
+			}
+			// The parts are modeled with their width along the x axis.
+			c, err := lookupColor(system, b.Color)
+			if err != nil {
+				return err
+			}
+			matrix := "1 0 0 0 1 0 0 0 1"
+			if b.Rotated {
+				matrix = "0 0 1 0 1 0 -1 0 0"
+			}
+			fmt.Fprintf(bw, "1 %s %g %g %g %s %s.dat\n", ldrawColor(c), x, top, z, matrix, b.Shape.LDraw)
+		}
+		fmt.Fprintf(bw, "0 STEP\n")
+	}
+	return bw.Flush()
+}
+
+// ldrawColor returns the LDraw color code of a palette color: its ID if it's an LDraw color number,
+// otherwise the LDraw direct color code.
+func ldrawColor(c palette.Color) string {
+	if _, err := strconv.Atoi(c.ID); err == nil {
+		return c.ID
+	}
+	return fmt.Sprintf("0x2%02X%02X%02X", c.R, c.G, c.B)
+}
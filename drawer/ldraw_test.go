@@ -0,0 +1,105 @@
+package drawer
+
+import (
+	"bytes"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/esimov/legoizer/palette"
+)
+
+func TestWriteLDraw(t *testing.T) {
+	tests := []struct {
+		name     string
+		standing bool
+		// lines are the expected part references, in order.
+		lines []string
+	}{
+		{"flat", false, []string{
+			"1 1 40 -24 20 1 0 0 0 1 0 0 0 1 3001.dat",
+			"1 1 20 -24 50 1 0 0 0 1 0 0 0 1 3004.dat",
+			"1 2 20 -48 20 1 0 0 0 1 0 0 0 1 3003.dat",
+		}},
+		{"standing", true, []string{
+			"1 1 40 -24 20 1 0 0 0 1 0 0 0 1 3001.dat",
+			"1 1 20 -24 10 1 0 0 0 1 0 0 0 1 3004.dat",
+			"1 2 20 -48 20 1 0 0 0 1 0 0 0 1 3003.dat",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteLDraw(&buf, "test", meshLayers(), Standard, tt.standing); err != nil {
+				t.Fatal(err)
+			}
+			var (
+				parts []string
+				steps int
+			)
+			for _, line := range strings.Split(buf.String(), "\n") {
+				if strings.HasPrefix(line, "1 ") {
+					parts = append(parts, line)
+				}
+				if line == "0 STEP" {
+					steps++
+				}
+			}
+			if !strings.HasPrefix(buf.String(), "0 test\n0 Name: test\n") {
+				t.Errorf("missing model header: %q", buf.String())
+			}
+			if steps != 2 {
+				t.Errorf("got %d building steps, want 2", steps)
+			}
+			if strings.Join(parts, "\n") != strings.Join(tt.lines, "\n") {
+				t.Errorf("got parts\n%s\nwant\n%s", strings.Join(parts, "\n"), strings.Join(tt.lines, "\n"))
+			}
+		})
+	}
+}
+
+func TestWriteLDrawRotatedAndDirectColors(t *testing.T) {
+	system := *Standard
+	system.Palette = palette.Palette{{Name: "Custom", NRGBA: color.NRGBA{R: 0x12, G: 0x34, B: 0x56, A: 0xff}}}
+	layers := [][]Brick{{
+		{X: 1, Y: 0, Shape: Standard.Shapes[1], Rotated: true, Color: studColor(system.Palette[0])},
+	}}
+	var buf bytes.Buffer
+	if err := WriteLDraw(&buf, "test", layers, &system, false); err != nil {
+		t.Fatal(err)
+	}
+	// The rotated 1x2 brick lies on the studs 1,0 and 1,1, turned around the vertical axis.
+	if want := "1 0x2123456 30 -24 20 0 0 1 0 1 0 -1 0 0 3004.dat\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("got\n%s\nwant the line %q", buf.String(), want)
+	}
+}
+
+func TestWriteLDrawSystems(t *testing.T) {
+	for _, system := range []*BrickSystem{Standard, Duplo, Nanoblock, Beads} {
+		shape := system.Shapes[len(system.Shapes)-1]
+		layers := [][]Brick{{{Shape: shape, Color: studColor(system.Palette[0])}}}
+		var buf bytes.Buffer
+		err := WriteLDraw(&buf, "test", layers, system, false)
+		if ldraw := system == Standard || system == Duplo; (err == nil) != ldraw {
+			t.Errorf("%s: got error %v, want an error %v", system.Name, err, !ldraw)
+		}
+	}
+}
+
+func TestLDrawColor(t *testing.T) {
+	tests := []struct {
+		c    palette.Color
+		want string
+	}{
+		{Standard.Palette[1], "1"},
+		{palette.Color{NRGBA: color.NRGBA{R: 0x12, G: 0x34, B: 0x56, A: 0xff}}, "0x2123456"},
+		// The IDs of the other systems are not LDraw color numbers.
+		{Nanoblock.Palette[3], "0x21F4EA8"},
+		{Beads.Palette[0], "0x2F1F1F1"},
+	}
+	for _, tt := range tests {
+		if got := ldrawColor(tt.c); got != tt.want {
+			t.Errorf("%v %v: got %q, want %q", tt.c.Name, tt.c.ID, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package drawer
+
+import (
+	"image/color"
+	"math"
+
+	"golang.org/x/image/font/basicfont"
+)
+
+// logoMinHeight is the smallest glyph height (in pixels) at which the embossed logo remains readable.
+// Below this limit the logo is not drawn at all.
+const logoMinHeight = 5.0
+
+// drawStudLogo embosses the logo text on top of the stud centered at xx, yy.
+// The text is scaled to fit inside the stud and it's shaded with the same light direction as the stud itself:
+// highlight on the top-left side and shadow on the bottom-right side.
+func (dc *context) drawStudLogo(xx, yy, radius float64, c color.NRGBA64) {
+	if dc.logo == "" || radius <= 0 {
+		return
+	}
+	face := basicfont.Face7x13
+	tw := float64(len([]rune(dc.logo)) * face.Advance)
+	th := float64(face.Ascent)
+
+	// Fit the text into ~70% of the stud diameter.
+	scale := math.Min(radius*1.4/tw, radius*0.8/th)
+	if th*scale < logoMinHeight {
+		return
+	}
+	// The emboss offset is expressed in the text space, so it has to be unscaled.
+	offset := math.Max(0.5, radius*0.04) / scale
+
+	dc.Push()
+	dc.SetFontFace(face)
+	dc.ScaleAbout(scale, scale, xx, yy)
+
+	// Glyphs are drawn from the baseline, so center them vertically based on the ascent.
+	x := xx - tw/2
+	y := yy + th/2
+
+	// Highlight
+	dc.SetColor(color.RGBA{255, 255, 255, 177})
+	dc.DrawString(dc.logo, x-offset, y-offset)
+
+	// Shadow
+	if isDark(c) {
+		dc.SetColor(color.RGBA{0, 0, 0, 177})
+	} else {
+		dc.SetColor(color.RGBA{0, 0, 0, 255})
+	}
+	dc.DrawString(dc.logo, x+offset, y+offset)
+
+	// Raised face, using the stud color
+	dc.SetRGB(rgb(c))
+	dc.DrawString(dc.logo, x, y)
+	dc.Pop()
+}
@@ -0,0 +1,41 @@
+package drawer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+func TestDrawStudLogo(t *testing.T) {
+	red := color.NRGBA64{R: 0xc9c9, G: 0x1a1a, B: 0x0909, A: 255}
+	// stud draws the logo on a 40x40 pixels stud and returns the stud pixels.
+	stud := func(logo string, radius float64) []byte {
+		dc := &context{gg.NewContext(40, 40), logo, SampleBox, StyleStud, false}
+		dc.SetRGB(rgb(red))
+		dc.Clear()
+		dc.drawStudLogo(20, 20, radius, red)
+		return dc.Image().(*image.RGBA).Pix
+	}
+	plain := stud("", 16)
+
+	tests := []struct {
+		name   string
+		logo   string
+		radius float64
+		drawn  bool
+	}{
+		{"no logo", "", 16, false},
+		{"readable", "LEGO", 16, true},
+		// The glyphs would be smaller than logoMinHeight.
+		{"too small", "LEGO", 4, false},
+		{"long text", "LEGOLEGOLEGOLEGO", 16, false},
+	}
+	for _, tt := range tests {
+		if drawn := !bytes.Equal(stud(tt.logo, tt.radius), plain); drawn != tt.drawn {
+			t.Errorf("%s: got logo drawn %v, want %v", tt.name, drawn, tt.drawn)
+		}
+	}
+}
@@ -0,0 +1,432 @@
+package drawer
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"math"
+
+	"github.com/esimov/legoizer/palette"
+)
+
+// The dimensions of the standard brick system, in millimeters.
+const (
+	brickHeight = 9.6
+	plateHeight = 3.2
+	studRadius  = 2.4
+	studHeight  = 1.7
+	// studSegments is the number of sides of the stud cylinders.
+	studSegments = 16
+)
+
+// Mesh is the 3D geometry of a brick mosaic, in millimeters with the z axis pointing up.
+type Mesh struct {
+	Objects []MeshObject
+}
+
+// MeshObject is a triangle mesh of a single color. Each brick is a closed shell, its studs being welded on top of its box.
+// The shells of neighboring bricks touch each other but are not welded together,
+// so printing the mesh as a single solid needs the shells to be united first, e.g. by the slicer.
+type MeshObject struct {
+	Name     string
+	Color    palette.Color
+	Vertices [][3]float64
+	// Faces are the vertex indices of the triangles, counter-clockwise when seen from the outside.
+	Faces [][3]int
+}
+
+// NewMesh builds the geometry of the brick layers: a box for each brick, topped with a cylinder for each stud
+// not covered by the layer above. The layers are laid out as in WriteLDraw, standing being set for the wall courses.
+// Each brick is a separate object, unless group is set, in which case the bricks of the same color are grouped into one object.
+// The grouped shells are only put together, not fused into a single solid.
+// The dimensions are scaled from the standard brick system according to the system pitch.
+// The fuse beads have no studs. A color missing from the system palette is an error.
+func NewMesh(layers [][]Brick, system *BrickSystem, standing, group bool) (*Mesh, error) {
+	if system == nil {
+		system = Standard
+	}
+	var (
+		mesh    = &Mesh{}
+		scale   = system.Pitch / Standard.Pitch
+		pitch   = system.Pitch
+		bottom  float64
+		height  = brickHeight * scale
+		grouped = make(map[palette.Color]int)
+	)
+	// footprint returns the brick footprint in the horizontal plane, in stud units.
+	footprint := func(b Brick) image.Rectangle {
+		if standing {
+			return image.Rect(b.X, 0, b.X+b.Shape.Width, b.Shape.Height)
+		}
+		return b.Bounds()
+	}
+	for k, bricks := range layers {
+		// The empty layers keep the height of the layer below.
+		for i, b := range bricks {
+			h := brickHeight * scale
+			if b.Shape.Plate {
+				h = plateHeight * scale
+			}
+			if i == 0 || h > height {
+				height = h
+			}
+		}
+		covered := make(map[image.Point]bool)
+		if k+1 < len(layers) {
+			for _, b := range layers[k+1] {
+				r := footprint(b)
+				for y := r.Min.Y; y < r.Max.Y; y++ {
+					for x := r.Min.X; x < r.Max.X; x++ {
+						covered[image.Pt(x, y)] = true
+					}
+				}
+			}
+		}
+		for _, b := range bricks {
+			c, err := lookupColor(system, b.Color)
+			if err != nil {
+				return nil, err
+			}
+			var obj *MeshObject
+			if i, ok := grouped[c]; ok && group {
+				obj = &mesh.Objects[i]
+			} else {
+				name := fmt.Sprintf("%s %d,%d", b.Shape, b.X, b.Y)
+				if group {
+					name = colorName(c)
+				}
+				mesh.Objects = append(mesh.Objects, MeshObject{Name: name, Color: c})
+				grouped[c] = len(mesh.Objects) - 1
+				obj = &mesh.Objects[len(mesh.Objects)-1]
+			}
+			r := footprint(b)
+			// The image rows are laid out along the negative y axis, so the mosaic is not mirrored when seen from above.
+			min := [3]float64{float64(r.Min.X) * pitch, -float64(r.Max.Y) * pitch, bottom}
+			max := [3]float64{float64(r.Max.X) * pitch, -float64(r.Min.Y) * pitch, bottom + height}
+			if system.Style == StyleBead {
+				obj.addBox(min, max)
+				continue
+			}
+			// The studs are indexed by their cell in the box top face, the first row being at the minimum y.
+			studs := make([]bool, r.Dx()*r.Dy())
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for x := r.Min.X; x < r.Max.X; x++ {
+					studs[(r.Max.Y-1-y)*r.Dx()+x-r.Min.X] = !covered[image.Pt(x, y)]
+				}
+			}
+			obj.addBrick(min, max, pitch, studs, studRadius*scale, studHeight*scale)
+		}
+		bottom += height
+	}
+	return mesh, nil
+}
+
+// addBox adds an axis aligned box defined by its minimum and maximum corners.
+func (o *MeshObject) addBox(min, max [3]float64) {
+	base := len(o.Vertices)
+	for i := 0; i < 8; i++ {
+		v := min
+		if i&1 != 0 {
+			v[0] = max[0]
+		}
+		if i&2 != 0 {
+			v[1] = max[1]
+		}
+		if i&4 != 0 {
+			v[2] = max[2]
+		}
+		o.Vertices = append(o.Vertices, v)
+	}
+	for _, f := range [][3]int{
+		{0, 2, 3}, {0, 3, 1}, // bottom
+		{4, 5, 7}, {4, 7, 6}, // top
+		{0, 1, 5}, {0, 5, 4}, // front
+		{2, 6, 7}, {2, 7, 3}, // back
+		{0, 4, 6}, {0, 6, 2}, // left
+		{1, 3, 7}, {1, 7, 5}, // right
+	} {
+		o.Faces = append(o.Faces, [3]int{base + f[0], base + f[1], base + f[2]})
+	}
+}
+
+// addBrick adds a box defined by its minimum and maximum corners, with the studs welded on its top face into a single shell.
+// The top face is divided into square cells of the pitch size, studs holding the cells with a stud, row by row.
+// Each cell border is split at the angles of the stud segments, so the neighboring cells and the stud rings share their vertices.
+func (o *MeshObject) addBrick(min, max [3]float64, pitch float64, studs []bool, radius, height float64) {
+	var (
+		nx    = int(math.Round((max[0] - min[0]) / pitch))
+		ny    = int(math.Round((max[1] - min[1]) / pitch))
+		index = make(map[[3]int64]int)
+	)
+	// vertex returns the index of the vertex at p, shared by all the faces of the shell.
+	vertex := func(p [3]float64) int {
+		key := [3]int64{int64(math.Round(p[0] * 1e6)), int64(math.Round(p[1] * 1e6)), int64(math.Round(p[2] * 1e6))}
+		if i, ok := index[key]; ok {
+			return i
+		}
+		o.Vertices = append(o.Vertices, p)
+		index[key] = len(o.Vertices) - 1
+		return index[key]
+	}
+	// border returns the vertex of the cell border in the direction of the k-th stud segment.
+	border := func(i, j, k int) int {
+		a := 2 * math.Pi * float64(k%studSegments) / studSegments
+		cos, sin := math.Cos(a), math.Sin(a)
+		d := pitch / 2 / math.Max(math.Abs(cos), math.Abs(sin))
+		return vertex([3]float64{
+			min[0] + (float64(i)+0.5)*pitch + d*cos,
+			min[1] + (float64(j)+0.5)*pitch + d*sin,
+			max[2],
+		})
+	}
+	face := func(a, b, c int) {
+		o.Faces = append(o.Faces, [3]int{a, b, c})
+	}
+
+	// The top face, counter-clockwise when seen from above.
+	for j := 0; j < ny; j++ {
+		for i := 0; i < nx; i++ {
+			cx, cy := min[0]+(float64(i)+0.5)*pitch, min[1]+(float64(j)+0.5)*pitch
+			if !studs[j*nx+i] {
+				center := vertex([3]float64{cx, cy, max[2]})
+				for k := 0; k < studSegments; k++ {
+					face(center, border(i, j, k), border(i, j, k+1))
+				}
+				continue
+			}
+			base := len(o.Vertices)
+			for k := 0; k < studSegments; k++ {
+				a := 2 * math.Pi * float64(k) / studSegments
+				px, py := cx+radius*math.Cos(a), cy+radius*math.Sin(a)
+				o.Vertices = append(o.Vertices, [3]float64{px, py, max[2]}, [3]float64{px, py, max[2] + height})
+			}
+			o.Vertices = append(o.Vertices, [3]float64{cx, cy, max[2] + height})
+			top := len(o.Vertices) - 1
+			for k := 0; k < studSegments; k++ {
+				b0, t0 := base+2*k, base+2*k+1
+				b1, t1 := base+2*((k+1)%studSegments), base+2*((k+1)%studSegments)+1
+				s0, s1 := border(i, j, k), border(i, j, k+1)
+				// The ring between the cell border and the stud, the stud wall and the stud top.
+				face(s0, s1, b1)
+				face(s0, b1, b0)
+				face(b0, b1, t1)
+				face(b0, t1, t0)
+				face(top, t0, t1)
+			}
+		}
+	}
+
+	// The top face outline, counter-clockwise when seen from above, split into the four sides starting at a corner.
+	var sides [4][]int
+	for i := 0; i < nx; i++ {
+		for k := 10; k < 14; k++ {
+			sides[0] = append(sides[0], border(i, 0, k))
+		}
+	}
+	for j := 0; j < ny; j++ {
+		for k := 14; k < 18; k++ {
+			sides[1] = append(sides[1], border(nx-1, j, k))
+		}
+	}
+	for i := nx - 1; i >= 0; i-- {
+		for k := 2; k < 6; k++ {
+			sides[2] = append(sides[2], border(i, ny-1, k))
+		}
+	}
+	for j := ny - 1; j >= 0; j-- {
+		for k := 6; k < 10; k++ {
+			sides[3] = append(sides[3], border(0, j, k))
+		}
+	}
+	// Each side face is a fan from its first bottom corner, the bottom corners lying under the top face corners.
+	for n, side := range sides {
+		side = append(side, sides[(n+1)%4][0])
+		var corners [2]int
+		for c, v := range []int{side[0], side[len(side)-1]} {
+			p := o.Vertices[v]
+			corners[c] = vertex([3]float64{p[0], p[1], min[2]})
+		}
+		face(corners[0], corners[1], side[len(side)-1])
+		for k := len(side) - 1; k > 0; k-- {
+			face(corners[0], side[k], side[k-1])
+		}
+	}
+	// The bottom face.
+	var bottom [4]int
+	for n, side := range sides {
+		p := o.Vertices[side[0]]
+		bottom[n] = vertex([3]float64{p[0], p[1], min[2]})
+	}
+	face(bottom[0], bottom[3], bottom[2])
+	face(bottom[0], bottom[2], bottom[1])
+}
+
+// WriteSTL writes the mesh in the binary STL format. The format has no colors, so all the objects are written as a single solid.
+func (m *Mesh) WriteSTL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var count uint32
+	for _, o := range m.Objects {
+		count += uint32(len(o.Faces))
+	}
+	header := make([]byte, 80)
+	copy(header, "legoizer")
+	bw.Write(header)
+	binary.Write(bw, binary.LittleEndian, count)
+
+	for _, o := range m.Objects {
+		for _, f := range o.Faces {
+			var tri [12]float32
+			n := normal(o.Vertices[f[0]], o.Vertices[f[1]], o.Vertices[f[2]])
+			for i := 0; i < 3; i++ {
+				tri[i] = float32(n[i])
+				for j := 0; j < 3; j++ {
+					tri[3+j*3+i] = float32(o.Vertices[f[j]][i])
+				}
+			}
+			binary.Write(bw, binary.LittleEndian, tri)
+			binary.Write(bw, binary.LittleEndian, uint16(0))
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteOBJ writes the mesh in the Wavefront OBJ format. The object colors are defined as materials,
+// referenced from the mtl material library written by WriteMTL.
+func (m *Mesh) WriteOBJ(w io.Writer, mtl string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "mtllib %s\n", mtl)
+	offset := 1
+	for _, o := range m.Objects {
+		fmt.Fprintf(bw, "o %s\n", o.Name)
+		fmt.Fprintf(bw, "usemtl %s\n", materialName(o.Color))
+		for _, v := range o.Vertices {
+			fmt.Fprintf(bw, "v %g %g %g\n", v[0], v[1], v[2])
+		}
+		for _, f := range o.Faces {
+			fmt.Fprintf(bw, "f %d %d %d\n", f[0]+offset, f[1]+offset, f[2]+offset)
+		}
+		offset += len(o.Vertices)
+	}
+	return bw.Flush()
+}
+
+// WriteMTL writes the OBJ material library holding the object colors.
+func (m *Mesh) WriteMTL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	written := make(map[string]bool)
+	for _, o := range m.Objects {
+		name := materialName(o.Color)
+		if written[name] {
+			continue
+		}
+		written[name] = true
+		fmt.Fprintf(bw, "newmtl %s\n", name)
+		fmt.Fprintf(bw, "Kd %.4f %.4f %.4f\n\n",
+			float64(o.Color.R)/0xff, float64(o.Color.G)/0xff, float64(o.Color.B)/0xff)
+	}
+	return bw.Flush()
+}
+
+// Write3MF writes the mesh as a 3MF package. The object colors are defined in a color group.
+func (m *Mesh) Write3MF(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"[Content_Types].xml", func(w io.Writer) error {
+			_, err := io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+ <Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+ <Default Extension="model" ContentType="application/vnd.ms-package.3dmanufacturing-3dmodel+xml"/>
+</Types>
+`)
+			return err
+		}},
+		{"_rels/.rels", func(w io.Writer) error {
+			_, err := io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+ <Relationship Target="/3D/3dmodel.model" Id="rel0" Type="http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel"/>
+</Relationships>
+`)
+			return err
+		}},
+		{"3D/3dmodel.model", m.write3MFModel},
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if err := f.write(fw); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// write3MFModel writes the 3MF model part.
+func (m *Mesh) write3MFModel(w io.Writer) error {
+	var (
+		bw     = bufio.NewWriter(w)
+		colors = make(map[string]int)
+		index  []int
+	)
+	fmt.Fprintln(bw, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(bw, `<model unit="millimeter" xml:lang="en-US" xmlns="http://schemas.microsoft.com/3dmanufacturing/core/2015/02" xmlns:m="http://schemas.microsoft.com/3dmanufacturing/material/2015/02">`)
+	fmt.Fprintln(bw, ` <resources>`)
+	fmt.Fprintln(bw, `  <m:colorgroup id="1">`)
+	for _, o := range m.Objects {
+		hex := palette.Hex(o.Color.NRGBA)
+		if _, ok := colors[hex]; !ok {
+			colors[hex] = len(colors)
+			fmt.Fprintf(bw, "   <m:color color=\"%s\"/>\n", hex)
+		}
+		index = append(index, colors[hex])
+	}
+	fmt.Fprintln(bw, `  </m:colorgroup>`)
+	for i, o := range m.Objects {
+		fmt.Fprintf(bw, "  <object id=\"%d\" type=\"model\" pid=\"1\" pindex=\"%d\">\n", i+2, index[i])
+		fmt.Fprintln(bw, `   <mesh>`)
+		fmt.Fprintln(bw, `    <vertices>`)
+		for _, v := range o.Vertices {
+			fmt.Fprintf(bw, "     <vertex x=\"%g\" y=\"%g\" z=\"%g\"/>\n", v[0], v[1], v[2])
+		}
+		fmt.Fprintln(bw, `    </vertices>`)
+		fmt.Fprintln(bw, `    <triangles>`)
+		for _, f := range o.Faces {
+			fmt.Fprintf(bw, "     <triangle v1=\"%d\" v2=\"%d\" v3=\"%d\"/>\n", f[0], f[1], f[2])
+		}
+		fmt.Fprintln(bw, `    </triangles>`)
+		fmt.Fprintln(bw, `   </mesh>`)
+		fmt.Fprintln(bw, `  </object>`)
+	}
+	fmt.Fprintln(bw, ` </resources>`)
+	fmt.Fprintln(bw, ` <build>`)
+	for i := range m.Objects {
+		fmt.Fprintf(bw, "  <item objectid=\"%d\"/>\n", i+2)
+	}
+	fmt.Fprintln(bw, ` </build>`)
+	fmt.Fprintln(bw, `</model>`)
+	return bw.Flush()
+}
+
+// materialName returns the OBJ material name of a color.
+func materialName(c palette.Color) string {
+	return "color_" + palette.Hex(c.NRGBA)[1:]
+}
+
+// normal returns the unit normal of a triangle.
+func normal(a, b, c [3]float64) [3]float64 {
+	u := [3]float64{b[0] - a[0], b[1] - a[1], b[2] - a[2]}
+	v := [3]float64{c[0] - a[0], c[1] - a[1], c[2] - a[2]}
+	n := [3]float64{u[1]*v[2] - u[2]*v[1], u[2]*v[0] - u[0]*v[2], u[0]*v[1] - u[1]*v[0]}
+	l := math.Sqrt(n[0]*n[0] + n[1]*n[1] + n[2]*n[2])
+	if l == 0 {
+		return n
+	}
+	return [3]float64{n[0] / l, n[1] / l, n[2] / l}
+}
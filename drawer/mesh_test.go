@@ -0,0 +1,200 @@
+package drawer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"image/color"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/esimov/legoizer/palette"
+)
+
+// studColor returns the stud color of a palette color.
+func studColor(c palette.Color) color.NRGBA64 {
+	return color.NRGBA64{R: uint16(c.R) * 0x101, G: uint16(c.G) * 0x101, B: uint16(c.B) * 0x101, A: 255}
+}
+
+// meshLayers returns two layers of bricks: a 2x4 brick and a 1x2 brick of the second palette color
+// under a 2x2 brick of the third palette color, covering the half of the 2x4 brick studs.
+func meshLayers() [][]Brick {
+	var (
+		bottom = studColor(Standard.Palette[1])
+		top    = studColor(Standard.Palette[2])
+		brick  = func(name string) Shape {
+			for _, s := range Standard.Shapes {
+				if s.Name == name && !s.Plate {
+					return s
+				}
+			}
+			panic(name)
+		}
+	)
+	return [][]Brick{
+		{{X: 0, Y: 0, Shape: brick("2x4"), Color: bottom}, {X: 0, Y: 2, Shape: brick("1x2"), Color: bottom}},
+		{{X: 0, Y: 0, Shape: brick("2x2"), Color: top}},
+	}
+}
+
+func TestNewMesh(t *testing.T) {
+	tests := []struct {
+		name    string
+		group   bool
+		objects int
+		// shells are the number of bricks of each object.
+		shells []int
+	}{
+		{"separate", false, 3, []int{1, 1, 1}},
+		{"grouped", true, 2, []int{2, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mesh, err := NewMesh(meshLayers(), Standard, false, tt.group)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(mesh.Objects) != tt.objects {
+				t.Fatalf("got %d objects, want %d", len(mesh.Objects), tt.objects)
+			}
+			var faces int
+			for i, o := range mesh.Objects {
+				faces += len(o.Faces)
+				// Each shell is closed and consistently oriented: every edge is shared by two faces in opposite directions.
+				edges := make(map[[2]int]int)
+				for _, f := range o.Faces {
+					for i := 0; i < 3; i++ {
+						edges[[2]int{f[i], f[(i+1)%3]}]++
+					}
+				}
+				for e, n := range edges {
+					if n != 1 || edges[[2]int{e[1], e[0]}] != 1 {
+						t.Errorf("%s: edge %v is not shared by two opposite faces", o.Name, e)
+					}
+				}
+				// The studs are welded on the brick boxes: each brick is a single shell, of Euler characteristic 2.
+				if euler := len(o.Vertices) - len(edges)/2 + len(o.Faces); euler != 2*tt.shells[i] {
+					t.Errorf("%s: got Euler characteristic %d, want %d", o.Name, euler, 2*tt.shells[i])
+				}
+			}
+			// A box of w x h studs has 2 bottom faces and 4w+1 or 4h+1 faces per side. The top face cells have 16 faces,
+			// or 80 with a stud. The 2x4 brick has 4 studs covered by the 2x2 brick.
+			box := func(w, h, studs int) int {
+				return 2 + 2*(4*w+1) + 2*(4*h+1) + 16*w*h + 64*studs
+			}
+			if want := box(4, 2, 4) + box(2, 1, 2) + box(2, 2, 4); faces != want {
+				t.Errorf("got %d faces, want %d", faces, want)
+			}
+		})
+	}
+}
+
+func TestMeshWriters(t *testing.T) {
+	mesh, err := NewMesh(meshLayers(), Standard, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vertices, faces int
+	for _, o := range mesh.Objects {
+		vertices += len(o.Vertices)
+		faces += len(o.Faces)
+	}
+
+	t.Run("stl", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := mesh.WriteSTL(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if want := 84 + 50*faces; buf.Len() != want {
+			t.Errorf("got %d bytes, want %d", buf.Len(), want)
+		}
+		if count := binary.LittleEndian.Uint32(buf.Bytes()[80:]); int(count) != faces {
+			t.Errorf("got %d triangles, want %d", count, faces)
+		}
+	})
+
+	t.Run("obj", func(t *testing.T) {
+		var obj, mtl bytes.Buffer
+		if err := mesh.WriteOBJ(&obj, "test.mtl"); err != nil {
+			t.Fatal(err)
+		}
+		if err := mesh.WriteMTL(&mtl); err != nil {
+			t.Fatal(err)
+		}
+		counts := make(map[string]int)
+		for _, line := range strings.Split(obj.String(), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			counts[fields[0]]++
+			if fields[0] == "usemtl" && !strings.Contains(mtl.String(), "newmtl "+fields[1]+"\n") {
+				t.Errorf("material %s missing from the material library", fields[1])
+			}
+		}
+		if counts["mtllib"] != 1 || counts["o"] != len(mesh.Objects) || counts["v"] != vertices || counts["f"] != faces {
+			t.Errorf("got %v, want %d objects, %d vertices and %d faces", counts, len(mesh.Objects), vertices, faces)
+		}
+		if n := strings.Count(mtl.String(), "newmtl "); n != 2 {
+			t.Errorf("got %d materials, want 2", n)
+		}
+	})
+
+	t.Run("3mf", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := mesh.Write3MF(&buf); err != nil {
+			t.Fatal(err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var model []byte
+		for _, f := range zr.File {
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadAll(r)
+			r.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.Name == "3D/3dmodel.model" {
+				model = data
+			}
+		}
+		var m struct {
+			Colors  []string `xml:"resources>colorgroup>color"`
+			Objects []struct {
+				Vertices  []struct{} `xml:"mesh>vertices>vertex"`
+				Triangles []struct {
+					V1 int `xml:"v1,attr"`
+					V2 int `xml:"v2,attr"`
+					V3 int `xml:"v3,attr"`
+				} `xml:"mesh>triangles>triangle"`
+			} `xml:"resources>object"`
+			Items []struct{} `xml:"build>item"`
+		}
+		if err := xml.Unmarshal(model, &m); err != nil {
+			t.Fatal(err)
+		}
+		if len(m.Objects) != len(mesh.Objects) || len(m.Items) != len(mesh.Objects) || len(m.Colors) != 2 {
+			t.Fatalf("got %d objects, %d items and %d colors", len(m.Objects), len(m.Items), len(m.Colors))
+		}
+		for i, o := range m.Objects {
+			if len(o.Vertices) != len(mesh.Objects[i].Vertices) || len(o.Triangles) != len(mesh.Objects[i].Faces) {
+				t.Errorf("object %d: got %d vertices and %d triangles", i, len(o.Vertices), len(o.Triangles))
+			}
+			for _, tri := range o.Triangles {
+				for _, v := range []int{tri.V1, tri.V2, tri.V3} {
+					if v < 0 || v >= len(o.Vertices) {
+						t.Errorf("object %d: vertex index %d out of range", i, v)
+					}
+				}
+			}
+		}
+	})
+}
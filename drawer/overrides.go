@@ -0,0 +1,132 @@
+package drawer
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/png" // register the PNG decoder for the override masks
+	"os"
+	"path/filepath"
+	"strings"
+
+	proc "github.com/esimov/legoizer/processor"
+)
+
+// Override forces the color of a stud or leaves the stud empty.
+// The stud coordinates are expressed in stud units, the top-left stud being at 0, 0.
+type Override struct {
+	X, Y int
+	// Color is the forced stud color. With a fixed palette it's snapped to the closest palette color.
+	Color color.Color
+	// Empty leaves the stud without brick.
+	Empty bool
+}
+
+// overrideEntry is the JSON representation of an override.
+type overrideEntry struct {
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	Color string `json:"color,omitempty"`
+	Empty bool   `json:"empty,omitempty"`
+}
+
+// LoadOverrides loads the stud overrides from a sidecar file.
+// The file can be either a JSON file holding a list of {"x", "y", "color", "empty"} entries,
+// or an image at stud resolution where each pixel overrides the corresponding stud:
+// fully transparent pixels leave the stud untouched, opaque pixels force the stud color
+// and semi-transparent pixels leave the stud empty.
+// The JSON colors are defined either in hex format or by their name, looked up first in the provided palette names
+// (indexed by their lower case name), then in the SVG 1.1 color names.
+func LoadOverrides(path string, names map[string]color.Color) ([]Override, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		var entries []overrideEntry
+		if err := json.NewDecoder(f).Decode(&entries); err != nil {
+			return nil, err
+		}
+		overrides := make([]Override, 0, len(entries))
+		for _, e := range entries {
+			o := Override{X: e.X, Y: e.Y, Empty: e.Empty}
+			if !e.Empty {
+				c, ok := names[strings.ToLower(strings.TrimSpace(e.Color))]
+				if !ok {
+					if c, err = proc.ParseColor(e.Color); err != nil {
+						return nil, fmt.Errorf("invalid color of stud %d,%d: %q", e.X, e.Y, e.Color)
+					}
+				}
+				o.Color = c
+			}
+			overrides = append(overrides, o)
+		}
+		return overrides, nil
+	}
+
+	mask, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		overrides []Override
+		bounds    = mask.Bounds()
+	)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(mask.At(x, y)).(color.NRGBA)
+			switch c.A {
+			case 0:
+				continue
+			case 0xff:
+				overrides = append(overrides, Override{X: x - bounds.Min.X, Y: y - bounds.Min.Y, Color: c})
+			default:
+				overrides = append(overrides, Override{X: x - bounds.Min.X, Y: y - bounds.Min.Y, Empty: true})
+			}
+		}
+	}
+	return overrides, nil
+}
+
+// applyOverrides paints the overridden studs over the quantized image and returns the used palette
+// extended with the forced colors, so the studs keep their forced color once snapped to the palette.
+// With a fixed palette the forced colors are replaced with the closest fixed palette color, so they exist as pieces.
+func applyOverrides(img *image.NRGBA64, used, fixed color.Palette, overrides []Override, cellSize int) color.Palette {
+	for _, o := range overrides {
+		cell := image.Rect(o.X*cellSize, o.Y*cellSize, (o.X+1)*cellSize, (o.Y+1)*cellSize).Intersect(img.Bounds())
+		if cell.Empty() {
+			continue
+		}
+		c := color.NRGBA64{}
+		if !o.Empty && o.Color != nil {
+			pc := o.Color
+			if len(fixed) > 0 {
+				pc = fixed.Convert(pc)
+			}
+			c = color.NRGBA64Model.Convert(pc).(color.NRGBA64)
+			c.A = 0xffff
+			if !hasColor(used, c) {
+				used = append(used, color.NRGBAModel.Convert(c))
+			}
+		}
+		for y := cell.Min.Y; y < cell.Max.Y; y++ {
+			for x := cell.Min.X; x < cell.Max.X; x++ {
+				img.SetNRGBA64(x, y, c)
+			}
+		}
+	}
+	return used
+}
+
+// hasColor checks if the palette holds the color.
+func hasColor(p color.Palette, c color.NRGBA64) bool {
+	for _, pc := range p {
+		if color.NRGBA64Model.Convert(pc) == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package drawer
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "legoizer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mask := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	mask.SetNRGBA(1, 0, color.NRGBA{R: 0xff, A: 0xff})
+	mask.SetNRGBA(2, 0, color.NRGBA{A: 0x80})
+	f, err := os.Create(filepath.Join(dir, "mask.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, mask); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	var (
+		red   = color.NRGBA{R: 0xff, A: 0xff}
+		names = map[string]color.Color{"dark red": color.NRGBA{R: 0x72, G: 0x0e, B: 0x0f, A: 0xff}}
+	)
+	tests := []struct {
+		name  string
+		file  string
+		input string
+		want  []Override
+		err   bool
+	}{
+		{"json", "a.json", `[{"x": 1, "y": 2, "color": "#ff0000"}, {"x": 3, "y": 4, "empty": true}]`,
+			[]Override{{X: 1, Y: 2, Color: red}, {X: 3, Y: 4, Empty: true}}, false},
+		{"json names", "names.json", `[{"x": 1, "y": 2, "color": "Dark Red"}, {"x": 3, "y": 4, "color": "red"}]`,
+			[]Override{{X: 1, Y: 2, Color: names["dark red"]}, {X: 3, Y: 4, Color: color.RGBA{R: 0xff, A: 0xff}}}, false},
+		{"json invalid color", "b.json", `[{"x": 1, "y": 2, "color": "reddish"}]`, nil, true},
+		{"json syntax", "c.json", `[{"x": 1,}]`, nil, true},
+		{"mask", "mask.png", "", []Override{{X: 1, Y: 0, Color: color.NRGBA{R: 0xff, A: 0xff}}, {X: 2, Y: 0, Empty: true}}, false},
+		{"missing", "missing.json", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if tt.input != "" {
+				if err := ioutil.WriteFile(path, []byte(tt.input), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := LoadOverrides(path, names)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if !tt.err && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	var (
+		img     = image.NewNRGBA64(image.Rect(0, 0, 8, 4))
+		white   = color.NRGBA64{R: 0xffff, G: 0xffff, B: 0xffff, A: 0xffff}
+		red     = color.NRGBA{R: 0xff, A: 0xff}
+		green   = color.NRGBA{G: 0xff, A: 0xff}
+		palette = color.Palette{red, color.NRGBA{B: 0xff, A: 0xff}}
+	)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			img.SetNRGBA64(x, y, white)
+		}
+	}
+	used := applyOverrides(img, palette[:1], palette, []Override{
+		{X: 0, Y: 0, Color: color.NRGBA{R: 0xf0, G: 0x10, A: 0xff}},
+		{X: 1, Y: 1, Empty: true},
+		// Out of the image, ignored.
+		{X: 9, Y: 9, Empty: true},
+		{X: 3, Y: 0, Color: color.NRGBA{B: 0xf0, A: 0xff}},
+	}, 2)
+
+	// The overrides cover cells of 2x2 pixels.
+	want := map[image.Point]color.Color{
+		{0, 0}: color.NRGBA64Model.Convert(red),
+		{1, 1}: color.NRGBA64Model.Convert(red),
+		{2, 2}: color.NRGBA64{},
+		{3, 3}: color.NRGBA64{},
+		{2, 0}: white,
+		{3, 1}: white,
+		{7, 3}: white,
+		{6, 0}: color.NRGBA64Model.Convert(palette[1]),
+	}
+	for p, c := range want {
+		if got := img.NRGBA64At(p.X, p.Y); got != c {
+			t.Errorf("pixel %v: got %v, want %v", p, got, c)
+		}
+	}
+	// The forced colors snapped to the fixed palette join the used palette.
+	if len(used) != 2 || color.NRGBA64Model.Convert(used[1]) != color.NRGBA64Model.Convert(palette[1]) {
+		t.Errorf("got used palette %v, want %v", used, palette)
+	}
+
+	// Without fixed palette the forced colors are kept as they are.
+	used = applyOverrides(img, palette[:1], nil, []Override{{X: 0, Y: 0, Color: green}}, 2)
+	if got := img.NRGBA64At(0, 0); got != color.NRGBA64Model.Convert(green) {
+		t.Errorf("pixel 0,0: got %v, want %v", got, green)
+	}
+	if len(used) != 2 || used[1] != green {
+		t.Errorf("got used palette %v, want red and green", used)
+	}
+}
+
+func TestProcessOverrideColor(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: 0xc0, G: 0x20, B: 0x20, A: 0xff})
+		}
+	}
+	blue := color.NRGBA{B: 0xff, A: 0xff}
+	quant := Quantizer{Quiet: true, Overrides: []Override{{X: 2, Y: 1, Color: blue}}}
+	quant.Process(img, 4, 10)
+
+	for _, b := range quant.Bricks {
+		if b.Bounds().Min == image.Pt(2, 1) && b.Bounds().Dx() == 1 && b.Bounds().Dy() == 1 {
+			if c := nrgba(b.Color); c != blue {
+				t.Errorf("got overridden stud color %v, want %v", c, blue)
+			}
+			return
+		}
+	}
+	t.Errorf("no brick on the overridden stud: %v", quant.Bricks)
+}
@@ -0,0 +1,125 @@
+package drawer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"image/color"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/esimov/legoizer/palette"
+)
+
+// PartCount is the number of pieces of the same shape and color.
+type PartCount struct {
+	Shape Shape
+	// Color is the system palette color of the pieces.
+	Color palette.Color
+	Count int
+}
+
+// PartsList counts the bricks by shape and color. The list is ordered by decreasing count.
+// It fails if a brick color is missing from the system palette.
+func PartsList(bricks []Brick, system *BrickSystem) ([]PartCount, error) {
+	if system == nil {
+		system = Standard
+	}
+	type key struct {
+		shape Shape
+		color color.NRGBA64
+	}
+	var (
+		counts = make(map[key]int)
+		keys   []key
+	)
+	for _, b := range bricks {
+		k := key{b.Shape, b.Color}
+		if _, ok := counts[k]; !ok {
+			keys = append(keys, k)
+		}
+		counts[k]++
+	}
+	parts := make([]PartCount, len(keys))
+	for i, k := range keys {
+		c, err := lookupColor(system, k.color)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = PartCount{Shape: k.shape, Color: c, Count: counts[k]}
+	}
+	sort.SliceStable(parts, func(i, j int) bool {
+		return parts[i].Count > parts[j].Count
+	})
+	return parts, nil
+}
+
+// WriteParts writes the parts list of each layer in CSV format.
+func WriteParts(w io.Writer, layers [][]Brick, system *BrickSystem) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"layer", "shape", "part", "color", "color id", "count"})
+	for k, bricks := range layers {
+		parts, err := PartsList(bricks, system)
+		if err != nil {
+			return err
+		}
+		for _, p := range parts {
+			cw.Write([]string{
+				strconv.Itoa(k + 1), p.Shape.String(), p.Shape.Part, colorName(p.Color), p.Color.ID, strconv.Itoa(p.Count),
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteInstructions writes the building instructions, layer by layer from the bottom.
+// Each step lists the pieces needed by the layer, followed by the position of each brick in stud units.
+func WriteInstructions(w io.Writer, layers [][]Brick, system *BrickSystem) error {
+	if system == nil {
+		system = Standard
+	}
+	bw := bufio.NewWriter(w)
+	for k, bricks := range layers {
+		parts, err := PartsList(bricks, system)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(bw, "Layer %d/%d: %d pieces\n", k+1, len(layers), len(bricks))
+		for _, p := range parts {
+			fmt.Fprintf(bw, "  %3dx %s %s\n", p.Count, p.Shape, colorName(p.Color))
+		}
+		fmt.Fprintln(bw)
+		for _, b := range bricks {
+			orientation := ""
+			if b.Rotated {
+				orientation = " (rotated)"
+			}
+			c, err := lookupColor(system, b.Color)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(bw, "  %d,%d\t%s %s%s\n", b.X, b.Y, b.Shape, colorName(c), orientation)
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+// lookupColor returns the system palette color of a stud color.
+func lookupColor(system *BrickSystem, c color.NRGBA64) (palette.Color, error) {
+	pc, ok := system.Palette.Lookup(nrgba(c))
+	if !ok {
+		return pc, fmt.Errorf("color %s is not in the %s brick system palette", palette.Hex(pc.NRGBA), system.Name)
+	}
+	return pc, nil
+}
+
+// colorName returns the name of a palette color, or its hex value if the color is not named.
+func colorName(c palette.Color) string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return palette.Hex(c.NRGBA)
+}
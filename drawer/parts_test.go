@@ -0,0 +1,69 @@
+package drawer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestExportsUsePaletteColors(t *testing.T) {
+	system, err := Standard.Allow("bricks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range samplingNames {
+		t.Run(name, func(t *testing.T) {
+			quant := Quantizer{Sampling: s, System: system, Quiet: true}
+			quant.Palette = system.Palette.Colors()
+			quant.Process(gradient(80, 60), 8, 6)
+
+			var parts bytes.Buffer
+			if err := WriteParts(&parts, quant.Layers, system); err != nil {
+				t.Fatal(err)
+			}
+			rows, err := csv.NewReader(&parts).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, row := range rows[1:] {
+				if row[2] == "" || row[3] == "" || row[4] == "" {
+					t.Errorf("incomplete parts list row: %v", row)
+				}
+			}
+
+			var ldr bytes.Buffer
+			if err := WriteLDraw(&ldr, "test", quant.Layers, system, false); err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range strings.Split(ldr.String(), "\n") {
+				if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "1" && strings.HasPrefix(fields[1], "0x2") {
+					t.Errorf("direct color in the LDraw model: %v", line)
+				}
+				if strings.HasPrefix(line, "0 // No ") {
+					t.Errorf("missing part in the LDraw model: %v", line)
+				}
+			}
+		})
+	}
+}
+
+func TestExportsRejectUnknownColors(t *testing.T) {
+	layers := [][]Brick{{
+		{X: 0, Y: 0, Shape: Standard.Shapes[0], Color: color.NRGBA64{R: 0x1234, G: 0x5678, B: 0x9abc, A: 255}},
+	}}
+	var buf bytes.Buffer
+	if err := WriteParts(&buf, layers, Standard); err == nil {
+		t.Error("WriteParts: expected an error for a color missing from the palette")
+	}
+	if err := WriteInstructions(&buf, layers, Standard); err == nil {
+		t.Error("WriteInstructions: expected an error for a color missing from the palette")
+	}
+	if err := WriteLDraw(&buf, "test", layers, Standard, false); err == nil {
+		t.Error("WriteLDraw: expected an error for a color missing from the palette")
+	}
+	if _, err := NewMesh(layers, Standard, false, false); err == nil {
+		t.Error("NewMesh: expected an error for a color missing from the palette")
+	}
+}
@@ -0,0 +1,89 @@
+package drawer
+
+import (
+	"image"
+	"image/color"
+)
+
+// Relief stacks layers of pieces on the studs, the number of layers following the height map.
+type Relief struct {
+	// Layers is the maximum number of layers stacked on a stud.
+	Layers int
+	// Depth is the height map, the brighter regions being the higher ones. It is stretched over the source image.
+	// If nil, the height is derived from the source image luminance.
+	Depth image.Image
+}
+
+// heights returns the number of layers stacked on each stud of the grid, between 1 and the number of relief layers.
+// The empty studs have no layer at all.
+func (r *Relief) heights(grid *studGrid, src image.Image, cellSize int) []int {
+	var (
+		heights = make([]int, len(grid.cells))
+		depth   = r.Depth
+		sb      = src.Bounds()
+	)
+	if depth == nil {
+		depth = src
+	}
+	db := depth.Bounds()
+	sx := float64(db.Dx()) / float64(sb.Dx())
+	sy := float64(db.Dy()) / float64(sb.Dy())
+
+	for y := 0; y < grid.height; y++ {
+		for x := 0; x < grid.width; x++ {
+			if grid.empty(x, y) {
+				continue
+			}
+			cell := image.Rect(
+				db.Min.X+int(float64(x*cellSize)*sx), db.Min.Y+int(float64(y*cellSize)*sy),
+				db.Min.X+int(float64((x+1)*cellSize)*sx), db.Min.Y+int(float64((y+1)*cellSize)*sy),
+			)
+			heights[y*grid.width+x] = 1 + int(round(getAvgLuminance(depth, cell)*float64(r.Layers-1)))
+		}
+	}
+	return heights
+}
+
+// stack lays out the relief layers, bottom first. Each layer covers the studs at least as high as the layer itself.
+// The preferred brick orientation alternates between the layers, so the seams of two consecutive layers are staggered.
+// The empty layers on top are dropped. The bricks of the previous layers lying on unchanged studs are kept.
+func (g *studGrid) stack(heights []int, layers int, shapes []Shape, previous [][]Brick, changed []bool) [][]Brick {
+	var (
+		stacked [][]Brick
+		layer   = newStudGrid(g.width, g.height)
+	)
+	for k := 0; k < layers; k++ {
+		for i, c := range g.cells {
+			if heights[i] > k {
+				layer.cells[i] = c
+			} else {
+				layer.cells[i] = color.NRGBA64{}
+			}
+		}
+		var keep []Brick
+		if k < len(previous) {
+			keep = layer.keep(previous[k], changed)
+		}
+		bricks := layer.layout(shapes, k%2 == 1, keep)
+		if len(bricks) == 0 {
+			break
+		}
+		stacked = append(stacked, bricks)
+	}
+	return stacked
+}
+
+// getAvgLuminance returns the average luminance of the image region, between 0 and 1.
+func getAvgLuminance(img image.Image, rect image.Rectangle) float64 {
+	rect = rect.Intersect(img.Bounds())
+	if rect.Empty() {
+		return 0
+	}
+	var sum float64
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			sum += float64(color.Gray16Model.Convert(img.At(x, y)).(color.Gray16).Y)
+		}
+	}
+	return sum / float64(rect.Dx()*rect.Dy()) / 0xffff
+}
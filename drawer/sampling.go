@@ -0,0 +1,214 @@
+package drawer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// Sampling defines the method used to compute the stud color from the pixels covered by a cell.
+type Sampling int
+
+const (
+	// SampleBox averages the cell pixels.
+	SampleBox Sampling = iota
+	// SampleLanczos weights the pixels around the cell center with a Lanczos kernel.
+	SampleLanczos
+	// SampleMedian takes the per channel median of the cell pixels.
+	SampleMedian
+	// SampleMode takes the most frequent color of the cell.
+	SampleMode
+	// SampleKuwahara takes the average color of the cell quadrant with the lowest variance, preserving the edges.
+	SampleKuwahara
+)
+
+var samplingNames = map[string]Sampling{
+	"box":      SampleBox,
+	"lanczos":  SampleLanczos,
+	"median":   SampleMedian,
+	"mode":     SampleMode,
+	"kuwahara": SampleKuwahara,
+}
+
+// ParseSampling returns the sampling method corresponding to the provided name.
+func ParseSampling(name string) (Sampling, error) {
+	s, ok := samplingNames[name]
+	if !ok {
+		return SampleBox, fmt.Errorf("unknown sampling method: %s", name)
+	}
+	return s, nil
+}
+
+// lanczosLobes is the number of lobes of the Lanczos kernel.
+const lanczosLobes = 2
+
+// cellColor returns the color of the cell based on the sampling method.
+func (s Sampling) cellColor(img *image.NRGBA64, cell image.Rectangle) color.NRGBA64 {
+	switch s {
+	case SampleLanczos:
+		return lanczosColor(img, cell)
+	case SampleMedian:
+		return medianColor(img.SubImage(cell).(*image.NRGBA64))
+	case SampleMode:
+		return modeColor(img.SubImage(cell).(*image.NRGBA64))
+	case SampleKuwahara:
+		return kuwaharaColor(img, cell)
+	}
+	return getAvgColor(img.SubImage(cell).(*image.NRGBA64))
+}
+
+// lanczosColor returns the Lanczos weighted color around the cell center.
+// The cell is left empty if its own pixels are all transparent, whatever the neighboring cells.
+func lanczosColor(img *image.NRGBA64, cell image.Rectangle) color.NRGBA64 {
+	avg := getAvgColor(img.SubImage(cell).(*image.NRGBA64))
+	if avg.A == 0 {
+		return avg
+	}
+	var (
+		size   = float64(cell.Dx())
+		cx     = float64(cell.Min.X) + size/2
+		cy     = float64(cell.Min.Y) + size/2
+		window = image.Rect(
+			int(cx-lanczosLobes*size), int(cy-lanczosLobes*size),
+			int(cx+lanczosLobes*size)+1, int(cy+lanczosLobes*size)+1,
+		).Intersect(img.Bounds())
+		r, g, b, w float64
+	)
+	for y := window.Min.Y; y < window.Max.Y; y++ {
+		wy := lanczos((float64(y) + 0.5 - cy) / size)
+		if wy == 0 {
+			continue
+		}
+		for x := window.Min.X; x < window.Max.X; x++ {
+			c := img.NRGBA64At(x, y)
+			if c.A == 0 {
+				continue
+			}
+			wxy := lanczos((float64(x)+0.5-cx)/size) * wy
+			r += float64(c.R) * wxy
+			g += float64(c.G) * wxy
+			b += float64(c.B) * wxy
+			w += wxy
+		}
+	}
+	if w <= 0 {
+		return avg
+	}
+	clamp := func(v float64) uint16 {
+		return uint16(math.Max(0, math.Min(65535, v/w)))
+	}
+	return color.NRGBA64{R: clamp(r), G: clamp(g), B: clamp(b), A: 255}
+}
+
+// lanczos is the Lanczos kernel function.
+func lanczos(x float64) float64 {
+	switch {
+	case x == 0:
+		return 1
+	case x <= -lanczosLobes || x >= lanczosLobes:
+		return 0
+	}
+	px := math.Pi * x
+	return lanczosLobes * math.Sin(px) * math.Sin(px/lanczosLobes) / (px * px)
+}
+
+// medianColor returns the per channel median color of the cell.
+func medianColor(img *image.NRGBA64) color.NRGBA64 {
+	var (
+		bounds  = img.Bounds()
+		r, g, b []int
+	)
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			c := img.NRGBA64At(x, y)
+			if c.A == 0 {
+				continue
+			}
+			r = append(r, int(c.R))
+			g = append(g, int(c.G))
+			b = append(b, int(c.B))
+		}
+	}
+	if len(r) == 0 {
+		return color.NRGBA64{}
+	}
+	median := func(v []int) uint16 {
+		sort.Ints(v)
+		return uint16(v[len(v)/2])
+	}
+	return color.NRGBA64{R: median(r), G: median(g), B: median(b), A: 255}
+}
+
+// modeColor returns the most frequent color of the cell.
+func modeColor(img *image.NRGBA64) color.NRGBA64 {
+	var (
+		bounds = img.Bounds()
+		hist   = make(map[color.NRGBA64]int)
+		best   color.NRGBA64
+	)
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			c := img.NRGBA64At(x, y)
+			if c.A == 0 {
+				continue
+			}
+			c.A = 255
+			hist[c]++
+			if hist[c] > hist[best] {
+				best = c
+			}
+		}
+	}
+	return best
+}
+
+// kuwaharaColor splits the cell into four quadrants and returns the average color of the most uniform one.
+func kuwaharaColor(img *image.NRGBA64, cell image.Rectangle) color.NRGBA64 {
+	var (
+		mid      = cell.Min.Add(cell.Size().Div(2))
+		best     color.NRGBA64
+		bestVar  = math.Inf(1)
+		quadrant = [4]image.Rectangle{
+			image.Rect(cell.Min.X, cell.Min.Y, mid.X+1, mid.Y+1),
+			image.Rect(mid.X, cell.Min.Y, cell.Max.X, mid.Y+1),
+			image.Rect(cell.Min.X, mid.Y, mid.X+1, cell.Max.Y),
+			image.Rect(mid.X, mid.Y, cell.Max.X, cell.Max.Y),
+		}
+	)
+	for _, q := range quadrant {
+		q = q.Intersect(img.Bounds())
+		if q.Empty() {
+			continue
+		}
+		var sum, sq [3]float64
+		n := 0.0
+		for y := q.Min.Y; y < q.Max.Y; y++ {
+			for x := q.Min.X; x < q.Max.X; x++ {
+				c := img.NRGBA64At(x, y)
+				if c.A == 0 {
+					continue
+				}
+				for i, v := range [3]float64{float64(c.R), float64(c.G), float64(c.B)} {
+					sum[i] += v
+					sq[i] += v * v
+				}
+				n++
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		variance := 0.0
+		for i := range sum {
+			mean := sum[i] / n
+			variance += sq[i]/n - mean*mean
+		}
+		if variance < bestVar {
+			bestVar = variance
+			best = color.NRGBA64{R: uint16(sum[0] / n), G: uint16(sum[1] / n), B: uint16(sum[2] / n), A: 255}
+		}
+	}
+	return best
+}
@@ -0,0 +1,59 @@
+package drawer
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// gradient returns an horizontal gradient from black to red, the green channel growing vertically.
+func gradient(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 255 / w), G: uint8(y * 255 / h), B: 0x40, A: 0xff})
+		}
+	}
+	return img
+}
+
+func TestSamplingKeepsPaletteColors(t *testing.T) {
+	for name, s := range samplingNames {
+		t.Run(name, func(t *testing.T) {
+			quant := Quantizer{Sampling: s, Quiet: true}
+			quant.Process(gradient(60, 60), 6, 7)
+
+			for _, b := range quant.Bricks {
+				c := nrgba(b.Color)
+				found := false
+				for _, pc := range quant.Used {
+					if color.NRGBAModel.Convert(pc) == c {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t.Errorf("brick at %d,%d: color %v is not in the quantized palette", b.X, b.Y, c)
+				}
+			}
+		})
+	}
+}
+
+func TestSamplingTransparentCell(t *testing.T) {
+	// The right half of the image is transparent, next to opaque red cells.
+	img := image.NewNRGBA64(image.Rect(0, 0, 40, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 20; x++ {
+			img.SetNRGBA64(x, y, color.NRGBA64{R: 0xffff, A: 0xffff})
+		}
+	}
+	for name, s := range samplingNames {
+		if c := s.cellColor(img, image.Rect(20, 0, 30, 10)); c.A != 0 {
+			t.Errorf("%s: got color %v for a transparent cell, want an empty stud", name, c)
+		}
+		if c := s.cellColor(img, image.Rect(10, 0, 20, 10)); c.A == 0 {
+			t.Errorf("%s: got an empty stud for an opaque cell", name)
+		}
+	}
+}
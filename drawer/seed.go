@@ -2,10 +2,23 @@ package drawer
 
 import (
 	"image"
-	"image/color"
 	"math"
 )
 
+// Noise defines the film-grain noise applied over the generated image as a post-processing step.
+// The zero value disables the noise stage.
+type Noise struct {
+	// Amount is the noise strength expressed in 8 bit color units. Zero disables the noise.
+	Amount float64
+	// Monochrome applies the same noise value to all the color channels of a pixel,
+	// otherwise each channel receives its own noise value.
+	Monochrome bool
+	// Gaussian uses a normal distribution with Amount/2 as standard deviation instead of a uniform distribution.
+	Gaussian bool
+	// Seed initializes the pseudo-random number generator, so the same seed always produces the same grain.
+	Seed int
+}
+
 type prng struct {
 	a    int
 	m    int
@@ -13,34 +26,66 @@ type prng struct {
 	div  float64
 }
 
-// noise apply a noise factor to the source image
-func noise(amount int, pxl image.Image, w, h int) *image.NRGBA64 {
-	noiseImg := image.NewNRGBA64(image.Rect(0, 0, w, h))
-	prng := &prng{
+// newPrng creates a new pseudo-random number generator initialized with the provided seed.
+func newPrng(seed int) *prng {
+	const m = 0x7fffffff
+	// The generator degenerates on multiples of the modulus, so the seed must lie in the [1, m-1] range.
+	seed %= m
+	if seed < 0 {
+		seed += m
+	}
+	if seed == 0 {
+		seed = 1
+	}
+	return &prng{
 		a:    16807,
-		m:    0x7fffffff,
-		rand: 1.0,
-		div:  1.0 / 0x7fffffff,
+		m:    m,
+		rand: seed,
+		div:  1.0 / m,
 	}
-	for x := 0; x < w; x++ {
-		for y := 0; y < h; y++ {
-			noise := (prng.randomSeed() - 0.1) * float64(amount)
-			r, g, b, a := pxl.At(x, y).RGBA()
-			rf, gf, bf := float64(r>>8), float64(g>>8), float64(b>>8)
+}
 
-			// Check if color do not overflow the maximum limit after noise has been applied
-			if math.Abs(rf+noise) < 255 && math.Abs(gf+noise) < 255 && math.Abs(bf+noise) < 255 {
-				rf += noise
-				gf += noise
-				bf += noise
+// noise apply a noise factor to the source image.
+// The image pixel buffer is modified in place.
+func noise(opts Noise, img *image.RGBA) *image.RGBA {
+	if opts.Amount == 0 {
+		return img
+	}
+	prng := newPrng(opts.Seed)
+	bounds := img.Bounds()
+
+	var n [3]float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if opts.Monochrome {
+				n[0] = prng.sample(opts) * opts.Amount
+				n[1], n[2] = n[0], n[0]
+			} else {
+				for i := range n {
+					n[i] = prng.sample(opts) * opts.Amount
+				}
+			}
+			i := img.PixOffset(x, y)
+			pix := img.Pix[i : i+4 : i+4]
+			// The pixels are alpha premultiplied, so the color channels cannot exceed the alpha value.
+			a := float64(pix[3])
+			for c := 0; c < 3; c++ {
+				pix[c] = uint8(math.Max(0, math.Min(a, float64(pix[c])+n[c]*a/255)))
 			}
-			r2 := max(0, min(255, uint8(rf)))
-			g2 := max(0, min(255, uint8(gf)))
-			b2 := max(0, min(255, uint8(bf)))
-			noiseImg.Set(x, y, color.RGBA{R: r2, G: g2, B: b2, A: uint8(a)})
 		}
 	}
-	return noiseImg
+	return img
+}
+
+// sample returns a zero centered noise value with unit amplitude,
+// following the distribution defined by the noise options.
+func (prng *prng) sample(opts Noise) float64 {
+	if opts.Gaussian {
+		// Box-Muller transform. The standard deviation is halved to keep the amplitude comparable with the uniform noise.
+		u1, u2 := prng.randomSeed(), prng.randomSeed()
+		return math.Sqrt(-2*math.Log(u1)) * math.Cos(2*math.Pi*u2) * 0.5
+	}
+	return prng.randomSeed() - 0.5
 }
 
 // nextLongRand generates a new random number based on the provided seed.
@@ -66,19 +111,3 @@ func (prng *prng) randomSeed() float64 {
 	prng.rand = prng.nextLongRand(prng.rand)
 	return float64(prng.rand) * prng.div
 }
-
-// min returns the smallest number between two numbers.
-func min(x, y uint8) uint8 {
-	if x < y {
-		return x
-	}
-	return y
-}
-
-// max returns the biggest number between two numbers.
-func max(x, y uint8) uint8 {
-	if x > y {
-		return x
-	}
-	return y
-}
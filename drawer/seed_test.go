@@ -0,0 +1,55 @@
+package drawer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestNoise(t *testing.T) {
+	// img returns a gray image, with a transparent pixel.
+	img := func() *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				img.SetRGBA(x, y, color.RGBA{R: 0x80, G: 0x80, B: 0x80, A: 0xff})
+			}
+		}
+		img.SetRGBA(3, 3, color.RGBA{})
+		return img
+	}
+	var (
+		src  = img().Pix
+		opts = Noise{Amount: 20, Seed: 7}
+		a    = noise(opts, img()).Pix
+	)
+	if bytes.Equal(a, src) {
+		t.Fatal("the noise left the image untouched")
+	}
+	if b := noise(opts, img()).Pix; !bytes.Equal(a, b) {
+		t.Error("the same seed produced different noise")
+	}
+	opts.Seed = 8
+	if b := noise(opts, img()).Pix; bytes.Equal(a, b) {
+		t.Error("different seeds produced the same noise")
+	}
+	if b := noise(Noise{Seed: 7}, img()).Pix; !bytes.Equal(b, src) {
+		t.Error("the zero amount noise changed the image")
+	}
+	// The transparent pixels stay transparent, the color channels not exceeding the alpha value.
+	if c := noise(opts, img()).RGBAAt(3, 3); c != (color.RGBA{}) {
+		t.Errorf("got transparent pixel %v", c)
+	}
+
+	for _, opts := range []Noise{{Amount: 20, Monochrome: true, Seed: 7}, {Amount: 20, Monochrome: true, Gaussian: true, Seed: 7}} {
+		out := noise(opts, img())
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				if c := out.RGBAAt(x, y); c.R != c.G || c.G != c.B {
+					t.Fatalf("%+v: got pixel %v, want the same noise on every channel", opts, c)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package drawer
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strings"
+
+	"github.com/esimov/legoizer/palette"
+)
+
+// Shape is a brick footprint expressed in studs.
+type Shape struct {
+	// Name is the common name of the piece, e.g. "2x4".
+	Name string
+	// Width and Height are the number of studs along the horizontal and vertical axis.
+	Width, Height int
+	// Part is the part identifier listed in the parts lists and the instructions, e.g. the LEGO design number.
+	Part string
+	// LDraw is the LDraw part file name, without the .dat extension. It's empty if the part has no LDraw model.
+	LDraw string
+	// Plate marks the thin pieces, a third of the height of a brick.
+	Plate bool
+}
+
+// RenderStyle defines how the studs of a brick system are rendered.
+type RenderStyle int
+
+const (
+	// StyleStud renders solid studs, like the standard bricks.
+	StyleStud RenderStyle = iota
+	// StyleHollowStud renders hollow studs, like the DUPLO bricks.
+	StyleHollowStud
+	// StyleBead renders fuse beads, each stud being a separate bead with a hole in the middle.
+	StyleBead
+)
+
+// BrickSystem defines the geometry and the catalog of a brick family.
+type BrickSystem struct {
+	Name string
+	// Pitch is the distance between two studs in millimeters.
+	Pitch float64
+	// Shapes are the available piece shapes.
+	Shapes []Shape
+	// Palette is the list of the available piece colors.
+	Palette palette.Palette
+	// Style is the render style of the studs.
+	Style RenderStyle
+}
+
+// Systems holds the built-in brick systems indexed by their name.
+var Systems = map[string]*BrickSystem{
+	"standard":  Standard,
+	"duplo":     Duplo,
+	"nanoblock": Nanoblock,
+	"beads":     Beads,
+}
+
+// Standard is the standard 8 mm brick system. The catalog holds both bricks and plates,
+// which should not be mixed in the same mosaic. Use Allow to select the pieces used by the layout.
+var Standard = &BrickSystem{
+	Name:  "standard",
+	Pitch: 8,
+	Shapes: []Shape{
+		{"1x1", 1, 1, "3005", "3005", false},
+		{"1x2", 2, 1, "3004", "3004", false},
+		{"1x3", 3, 1, "3622", "3622", false},
+		{"1x4", 4, 1, "3010", "3010", false},
+		{"1x6", 6, 1, "3009", "3009", false},
+		{"1x8", 8, 1, "3008", "3008", false},
+		{"2x2", 2, 2, "3003", "3003", false},
+		{"2x3", 3, 2, "3002", "3002", false},
+		{"2x4", 4, 2, "3001", "3001", false},
+		{"2x6", 6, 2, "2456", "2456", false},
+		{"2x8", 8, 2, "3007", "3007", false},
+		{"2x10", 10, 2, "3006", "3006", false},
+		{"4x6", 6, 4, "2356", "2356", false},
+		{"1x1", 1, 1, "3024", "3024", true},
+		{"1x2", 2, 1, "3023", "3023", true},
+		{"1x3", 3, 1, "3623", "3623", true},
+		{"1x4", 4, 1, "3710", "3710", true},
+		{"1x6", 6, 1, "3666", "3666", true},
+		{"1x8", 8, 1, "3460", "3460", true},
+		{"2x2", 2, 2, "3022", "3022", true},
+		{"2x3", 3, 2, "3021", "3021", true},
+		{"2x4", 4, 2, "3020", "3020", true},
+		{"2x6", 6, 2, "3795", "3795", true},
+		{"2x8", 8, 2, "3034", "3034", true},
+		{"2x10", 10, 2, "3832", "3832", true},
+		{"2x12", 12, 2, "2445", "2445", true},
+		{"4x4", 4, 4, "3031", "3031", true},
+		{"4x6", 6, 4, "3032", "3032", true},
+	},
+	Palette: palette.Palette{
+		{Name: "Black", ID: "0", NRGBA: color.NRGBA{0x05, 0x13, 0x1d, 0xff}},
+		{Name: "Blue", ID: "1", NRGBA: color.NRGBA{0x00, 0x55, 0xbf, 0xff}},
+		{Name: "Green", ID: "2", NRGBA: color.NRGBA{0x25, 0x7a, 0x3e, 0xff}},
+		{Name: "Red", ID: "4", NRGBA: color.NRGBA{0xc9, 0x1a, 0x09, 0xff}},
+		{Name: "Dark Pink", ID: "5", NRGBA: color.NRGBA{0xc8, 0x70, 0xa0, 0xff}},
+		{Name: "Brown", ID: "6", NRGBA: color.NRGBA{0x58, 0x39, 0x27, 0xff}},
+		{Name: "Yellow", ID: "14", NRGBA: color.NRGBA{0xf2, 0xcd, 0x37, 0xff}},
+		{Name: "White", ID: "15", NRGBA: color.NRGBA{0xff, 0xff, 0xff, 0xff}},
+		{Name: "Tan", ID: "19", NRGBA: color.NRGBA{0xe4, 0xcd, 0x9e, 0xff}},
+		{Name: "Orange", ID: "25", NRGBA: color.NRGBA{0xfe, 0x8a, 0x18, 0xff}},
+		{Name: "Magenta", ID: "26", NRGBA: color.NRGBA{0x92, 0x39, 0x78, 0xff}},
+		{Name: "Lime", ID: "27", NRGBA: color.NRGBA{0xbb, 0xe9, 0x0b, 0xff}},
+		{Name: "Dark Tan", ID: "28", NRGBA: color.NRGBA{0x95, 0x8a, 0x73, 0xff}},
+		{Name: "Reddish Brown", ID: "70", NRGBA: color.NRGBA{0x58, 0x2a, 0x12, 0xff}},
+		{Name: "Light Bluish Gray", ID: "71", NRGBA: color.NRGBA{0xa0, 0xa5, 0xa9, 0xff}},
+		{Name: "Dark Bluish Gray", ID: "72", NRGBA: color.NRGBA{0x6c, 0x6e, 0x68, 0xff}},
+		{Name: "Medium Blue", ID: "73", NRGBA: color.NRGBA{0x5a, 0x93, 0xdb, 0xff}},
+		{Name: "Light Nougat", ID: "78", NRGBA: color.NRGBA{0xf6, 0xd7, 0xb3, 0xff}},
+		{Name: "Medium Nougat", ID: "84", NRGBA: color.NRGBA{0xaa, 0x7d, 0x55, 0xff}},
+		{Name: "Nougat", ID: "92", NRGBA: color.NRGBA{0xd0, 0x91, 0x68, 0xff}},
+		{Name: "Bright Light Orange", ID: "191", NRGBA: color.NRGBA{0xf8, 0xbb, 0x3d, 0xff}},
+		{Name: "Bright Light Yellow", ID: "226", NRGBA: color.NRGBA{0xff, 0xf0, 0x3a, 0xff}},
+		{Name: "Dark Blue", ID: "272", NRGBA: color.NRGBA{0x0a, 0x34, 0x63, 0xff}},
+		{Name: "Dark Green", ID: "288", NRGBA: color.NRGBA{0x18, 0x46, 0x32, 0xff}},
+		{Name: "Dark Red", ID: "320", NRGBA: color.NRGBA{0x72, 0x0e, 0x0f, 0xff}},
+		{Name: "Dark Azure", ID: "321", NRGBA: color.NRGBA{0x07, 0x8b, 0xc9, 0xff}},
+		{Name: "Medium Azure", ID: "322", NRGBA: color.NRGBA{0x36, 0xae, 0xbf, 0xff}},
+	},
+	Style: StyleStud,
+}
+
+// Duplo is the 16 mm DUPLO brick system. There is no 1x1 DUPLO brick in its catalog,
+// so the single studs of a mosaic are left uncovered, see Quantizer.Uncovered.
+var Duplo = &BrickSystem{
+	Name:  "duplo",
+	Pitch: 16,
+	Shapes: []Shape{
+		{"1x2", 2, 1, "4066", "4066", false},
+		{"2x2", 2, 2, "3437", "3437", false},
+		{"2x4", 4, 2, "3011", "3011", false},
+	},
+	Palette: palette.Palette{
+		{Name: "Black", ID: "0", NRGBA: color.NRGBA{0x05, 0x13, 0x1d, 0xff}},
+		{Name: "Blue", ID: "1", NRGBA: color.NRGBA{0x00, 0x55, 0xbf, 0xff}},
+		{Name: "Green", ID: "2", NRGBA: color.NRGBA{0x25, 0x7a, 0x3e, 0xff}},
+		{Name: "Red", ID: "4", NRGBA: color.NRGBA{0xc9, 0x1a, 0x09, 0xff}},
+		{Name: "Dark Pink", ID: "5", NRGBA: color.NRGBA{0xc8, 0x70, 0xa0, 0xff}},
+		{Name: "Yellow", ID: "14", NRGBA: color.NRGBA{0xf2, 0xcd, 0x37, 0xff}},
+		{Name: "White", ID: "15", NRGBA: color.NRGBA{0xff, 0xff, 0xff, 0xff}},
+		{Name: "Orange", ID: "25", NRGBA: color.NRGBA{0xfe, 0x8a, 0x18, 0xff}},
+		{Name: "Lime", ID: "27", NRGBA: color.NRGBA{0xbb, 0xe9, 0x0b, 0xff}},
+		{Name: "Reddish Brown", ID: "70", NRGBA: color.NRGBA{0x58, 0x2a, 0x12, 0xff}},
+		{Name: "Light Bluish Gray", ID: "71", NRGBA: color.NRGBA{0xa0, 0xa5, 0xa9, 0xff}},
+		{Name: "Medium Blue", ID: "73", NRGBA: color.NRGBA{0x5a, 0x93, 0xdb, 0xff}},
+	},
+	Style: StyleHollowStud,
+}
+
+// Nanoblock is the 4 mm nanoblock system.
+var Nanoblock = &BrickSystem{
+	Name:  "nanoblock",
+	Pitch: 4,
+	Shapes: []Shape{
+		{"1x1", 1, 1, "nb-1x1", "", false},
+		{"1x2", 2, 1, "nb-1x2", "", false},
+		{"1x3", 3, 1, "nb-1x3", "", false},
+		{"1x4", 4, 1, "nb-1x4", "", false},
+		{"2x2", 2, 2, "nb-2x2", "", false},
+		{"2x3", 3, 2, "nb-2x3", "", false},
+		{"2x4", 4, 2, "nb-2x4", "", false},
+	},
+	Palette: palette.Palette{
+		{Name: "Black", ID: "black", NRGBA: color.NRGBA{0x1e, 0x1e, 0x1e, 0xff}},
+		{Name: "White", ID: "white", NRGBA: color.NRGBA{0xf5, 0xf5, 0xf5, 0xff}},
+		{Name: "Red", ID: "red", NRGBA: color.NRGBA{0xd2, 0x1f, 0x27, 0xff}},
+		{Name: "Blue", ID: "blue", NRGBA: color.NRGBA{0x1f, 0x4e, 0xa8, 0xff}},
+		{Name: "Yellow", ID: "yellow", NRGBA: color.NRGBA{0xf7, 0xd1, 0x17, 0xff}},
+		{Name: "Green", ID: "green", NRGBA: color.NRGBA{0x2d, 0x8a, 0x3c, 0xff}},
+		{Name: "Orange", ID: "orange", NRGBA: color.NRGBA{0xf0, 0x83, 0x00, 0xff}},
+		{Name: "Brown", ID: "brown", NRGBA: color.NRGBA{0x6b, 0x3e, 0x26, 0xff}},
+		{Name: "Gray", ID: "gray", NRGBA: color.NRGBA{0x8c, 0x8c, 0x8c, 0xff}},
+		{Name: "Pink", ID: "pink", NRGBA: color.NRGBA{0xf2, 0x9c, 0xb8, 0xff}},
+		{Name: "Light Blue", ID: "light-blue", NRGBA: color.NRGBA{0x6e, 0xb4, 0xe6, 0xff}},
+		{Name: "Beige", ID: "beige", NRGBA: color.NRGBA{0xe6, 0xd2, 0xaa, 0xff}},
+	},
+	Style: StyleStud,
+}
+
+// Beads is the 5 mm fuse beads system (Perler, Hama). Each bead is a separate 1x1 piece.
+var Beads = &BrickSystem{
+	Name:  "beads",
+	Pitch: 5,
+	Shapes: []Shape{
+		{"bead", 1, 1, "bead", "", false},
+	},
+	Palette: palette.Palette{
+		{Name: "White", ID: "P01", NRGBA: color.NRGBA{0xf1, 0xf1, 0xf1, 0xff}},
+		{Name: "Cream", ID: "P02", NRGBA: color.NRGBA{0xe0, 0xde, 0xa9, 0xff}},
+		{Name: "Yellow", ID: "P03", NRGBA: color.NRGBA{0xec, 0xd8, 0x00, 0xff}},
+		{Name: "Orange", ID: "P04", NRGBA: color.NRGBA{0xed, 0x61, 0x20, 0xff}},
+		{Name: "Red", ID: "P05", NRGBA: color.NRGBA{0xbf, 0x26, 0x33, 0xff}},
+		{Name: "Bubblegum", ID: "P06", NRGBA: color.NRGBA{0xdd, 0x66, 0x94, 0xff}},
+		{Name: "Purple", ID: "P07", NRGBA: color.NRGBA{0x60, 0x40, 0x89, 0xff}},
+		{Name: "Dark Blue", ID: "P08", NRGBA: color.NRGBA{0x2b, 0x3f, 0x87, 0xff}},
+		{Name: "Light Blue", ID: "P09", NRGBA: color.NRGBA{0x33, 0x70, 0xc0, 0xff}},
+		{Name: "Dark Green", ID: "P10", NRGBA: color.NRGBA{0x1c, 0x75, 0x3e, 0xff}},
+		{Name: "Light Green", ID: "P11", NRGBA: color.NRGBA{0x56, 0xba, 0x9f, 0xff}},
+		{Name: "Brown", ID: "P12", NRGBA: color.NRGBA{0x51, 0x39, 0x31, 0xff}},
+		{Name: "Grey", ID: "P17", NRGBA: color.NRGBA{0x8a, 0x8d, 0x91, 0xff}},
+		{Name: "Black", ID: "P18", NRGBA: color.NRGBA{0x2e, 0x2f, 0x32, 0xff}},
+		{Name: "Rust", ID: "P20", NRGBA: color.NRGBA{0x8c, 0x37, 0x2c, 0xff}},
+		{Name: "Light Brown", ID: "P21", NRGBA: color.NRGBA{0x81, 0x5d, 0x34, 0xff}},
+		{Name: "Tan", ID: "P35", NRGBA: color.NRGBA{0xe4, 0xa5, 0x83, 0xff}},
+		{Name: "Peach", ID: "P33", NRGBA: color.NRGBA{0xee, 0xba, 0xb2, 0xff}},
+	},
+	Style: StyleBead,
+}
+
+// LookupSystem returns the built-in brick system with the provided name.
+func LookupSystem(name string) (*BrickSystem, error) {
+	s, ok := Systems[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown brick system: %s", name)
+	}
+	return s, nil
+}
+
+// String returns the shape identifier used in the allow-lists: the shape name, prefixed with "plate-" for plates.
+func (s Shape) String() string {
+	if s.Plate {
+		return "plate-" + s.Name
+	}
+	return s.Name
+}
+
+// Allow returns a copy of the brick system restricted to the listed shapes.
+// Besides the shape identifiers, the "bricks", "plates" and "all" names select the whole category.
+func (s *BrickSystem) Allow(names ...string) (*BrickSystem, error) {
+	allowed := *s
+	allowed.Shapes = nil
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, shape := range s.Shapes {
+			if name == "all" || name == shape.String() ||
+				(name == "bricks" && !shape.Plate) || (name == "plates" && shape.Plate) {
+				allowed.Shapes = append(allowed.Shapes, shape)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no %q shape in the %s brick system", name, s.Name)
+		}
+	}
+	if err := allowed.Validate(); err != nil {
+		return nil, err
+	}
+	return &allowed, nil
+}
+
+// Validate checks that each system shape has a part identifier. Without a 1x1 shape
+// the single studs of a mosaic are left uncovered, see Quantizer.Uncovered.
+func (s *BrickSystem) Validate() error {
+	for _, shape := range s.Shapes {
+		if shape.Part == "" {
+			return fmt.Errorf("the %s shape of the %s brick system has no part", shape, s.Name)
+		}
+	}
+	return nil
+}
+
+// HasLDraw checks if all the system shapes have an LDraw part, so the system layouts can be written as LDraw models.
+func (s *BrickSystem) HasLDraw() bool {
+	for _, shape := range s.Shapes {
+		if shape.LDraw == "" {
+			return false
+		}
+	}
+	return len(s.Shapes) > 0
+}
+
+// shapes returns the system shapes ordered by decreasing area, the widest shapes first.
+func (s *BrickSystem) shapes() []Shape {
+	shapes := append([]Shape(nil), s.Shapes...)
+	sort.SliceStable(shapes, func(i, j int) bool {
+		ai, aj := shapes[i].Width*shapes[i].Height, shapes[j].Width*shapes[j].Height
+		if ai != aj {
+			return ai > aj
+		}
+		return shapes[i].Width > shapes[j].Width
+	})
+	return shapes
+}
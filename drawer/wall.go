@@ -0,0 +1,137 @@
+package drawer
+
+import "sort"
+
+// Seam is a vertical joint between two bricks running through several consecutive courses of a standing wall.
+type Seam struct {
+	// X is the stud column on the left of which the joint lies.
+	X int
+	// Y is the top row of the joint.
+	Y int
+	// Rows is the number of courses the joint runs through.
+	Rows int
+}
+
+// wall lays out the non empty studs as a standing wall, each row being a course of bricks seen from the side.
+// The courses are laid out from the bottom, each brick being chosen so that its end joint
+// does not line up with a joint of the course below. The returned layers are the courses, bottom first,
+// including the empty ones.
+// Since the bricks of two adjacent colors always meet at a joint, some joints can't be staggered.
+// These are reported as weak seams when they run through more than one course.
+// The bricks of the previous courses lying on unchanged studs are kept.
+func (g *studGrid) wall(shapes []Shape, previous [][]Brick, changed []bool) ([][]Brick, []Seam) {
+	var (
+		courses [][]Brick
+		seams   = make([][]bool, g.height)
+		bond    []Shape
+	)
+	// The wall is as thick as the thinnest shapes, so only these can be used.
+	for _, s := range shapes {
+		if len(bond) > 0 && s.Height > bond[0].Height {
+			continue
+		}
+		if len(bond) > 0 && s.Height < bond[0].Height {
+			bond = bond[:0]
+		}
+		bond = append(bond, s)
+	}
+	sort.SliceStable(bond, func(i, j int) bool {
+		return bond[i].Width > bond[j].Width
+	})
+	fits := func(x, y, w int, taken []bool) bool {
+		if x+w > g.width {
+			return false
+		}
+		for i := x; i < x+w; i++ {
+			if taken[i] || g.empty(i, y) || !sameColor(g.at(i, y), g.at(x, y)) {
+				return false
+			}
+		}
+		return true
+	}
+	for y := g.height - 1; y >= 0; y-- {
+		var (
+			course []Brick
+			below  []bool
+			kept   = make(map[int]Shape)
+			taken  = make([]bool, g.width)
+		)
+		seams[y] = make([]bool, g.width+1)
+		if y < g.height-1 {
+			below = seams[y+1]
+		}
+		if k := g.height - 1 - y; k < len(previous) {
+		next:
+			for _, b := range previous[k] {
+				if b.Y != y || b.X+b.Shape.Width > g.width {
+					continue
+				}
+				for i := b.X; i < b.X+b.Shape.Width; i++ {
+					if changed[y*g.width+i] || g.empty(i, y) {
+						continue next
+					}
+				}
+				kept[b.X] = b.Shape
+				for i := b.X; i < b.X+b.Shape.Width; i++ {
+					taken[i] = true
+				}
+			}
+		}
+		for x := 0; x < g.width; {
+			if g.empty(x, y) {
+				x++
+				continue
+			}
+			best, reused := kept[x]
+			found := reused
+			for _, s := range bond {
+				if reused {
+					break
+				}
+				if !fits(x, y, s.Width, taken) {
+					continue
+				}
+				end := x + s.Width
+				joint := end < g.width && !g.empty(end, y)
+				if !found {
+					best, found = s, true
+				}
+				if !joint || below == nil || !below[end] {
+					best = s
+					break
+				}
+			}
+			if !found {
+				// No shape covers the stud, it's reported as uncovered.
+				x++
+				continue
+			}
+			if x > 0 && !g.empty(x-1, y) {
+				seams[y][x] = true
+			}
+			course = append(course, Brick{X: x, Y: y, Shape: best, Color: g.at(x, y)})
+			x += best.Width
+		}
+		courses = append(courses, course)
+	}
+	return courses, weakSeams(seams, g.width)
+}
+
+// weakSeams returns the joints running through more than one course.
+func weakSeams(seams [][]bool, width int) []Seam {
+	var weak []Seam
+	for x := 1; x < width; x++ {
+		rows := 0
+		for y := len(seams) - 1; y >= -1; y-- {
+			if y >= 0 && seams[y][x] {
+				rows++
+				continue
+			}
+			if rows > 1 {
+				weak = append(weak, Seam{X: x, Y: y + 1, Rows: rows})
+			}
+			rows = 0
+		}
+	}
+	return weak
+}
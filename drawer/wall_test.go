@@ -0,0 +1,68 @@
+package drawer
+
+import (
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+// wallGrid returns a stud grid whose columns left of split are red, the other ones blue.
+func wallGrid(width, height, split int) *studGrid {
+	g := newStudGrid(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBA64{R: 0xffff, A: 255}
+			if x >= split {
+				c = color.NRGBA64{B: 0xffff, A: 255}
+			}
+			g.set(x, y, c)
+		}
+	}
+	return g
+}
+
+func TestWallStaggersJoints(t *testing.T) {
+	system, err := Standard.Allow("bricks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := wallGrid(24, 6, 24)
+	courses, seams := g.wall(system.shapes(), nil, nil)
+	if len(seams) > 0 {
+		t.Errorf("got seams %v in a uniform wall", seams)
+	}
+	var bricks []Brick
+	for _, c := range courses {
+		bricks = append(bricks, c...)
+	}
+	checkCoverage(t, g, bricks)
+
+	// No joint runs through two consecutive courses.
+	joints := make([]map[int]bool, len(courses))
+	for k, course := range courses {
+		joints[k] = make(map[int]bool)
+		for _, b := range course {
+			if b.X > 0 {
+				joints[k][b.X] = true
+			}
+		}
+		for x := range joints[k] {
+			if k > 0 && joints[k-1][x] {
+				t.Errorf("courses %d and %d: the joint left of column %d is not staggered", k, k+1, x)
+			}
+		}
+	}
+}
+
+func TestWallColorSeam(t *testing.T) {
+	system, err := Standard.Allow("bricks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The bricks of the two colors meet at the same joint in every course.
+	g := wallGrid(16, 5, 7)
+	_, seams := g.wall(system.shapes(), nil, nil)
+	if want := []Seam{{X: 7, Y: 0, Rows: 5}}; !reflect.DeepEqual(seams, want) {
+		t.Errorf("got seams %v, want %v", seams, want)
+	}
+}
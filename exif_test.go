@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// tiffHeader returns a TIFF structure whose first IFD holds a single entry with the provided tag, type and value.
+func tiffHeader(order binary.ByteOrder, tag, typ, value uint16) []byte {
+	data := make([]byte, 8+2+12+4)
+	if order == binary.LittleEndian {
+		copy(data, "II")
+	} else {
+		copy(data, "MM")
+	}
+	order.PutUint16(data[2:], 42)
+	order.PutUint32(data[4:], 8)
+	order.PutUint16(data[8:], 1)
+	order.PutUint16(data[10:], tag)
+	order.PutUint16(data[12:], typ)
+	order.PutUint32(data[14:], 1)
+	order.PutUint16(data[18:], value)
+	return data
+}
+
+// jpegHeader returns the start of a JPEG file with an APP0 segment followed by an APP1 Exif segment holding the TIFF structure.
+func jpegHeader(tiff []byte) []byte {
+	data := []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x07, 'J', 'F', 'I', 'F', 0}
+	exif := append([]byte("Exif\x00\x00"), tiff...)
+	data = append(data, 0xff, 0xe1, byte((len(exif)+2)>>8), byte(len(exif)+2))
+	data = append(data, exif...)
+	return append(data, 0xff, 0xda, 0x00, 0x02)
+}
+
+func TestExifOrientation(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"tiff little endian", tiffHeader(binary.LittleEndian, 0x0112, 3, 6), 6},
+		{"tiff big endian", tiffHeader(binary.BigEndian, 0x0112, 3, 8), 8},
+		{"jpeg", jpegHeader(tiffHeader(binary.BigEndian, 0x0112, 3, 3)), 3},
+		{"other tag", jpegHeader(tiffHeader(binary.LittleEndian, 0x0110, 3, 6)), 1},
+		{"wrong type", tiffHeader(binary.LittleEndian, 0x0112, 4, 6), 1},
+		{"invalid value", tiffHeader(binary.LittleEndian, 0x0112, 3, 9), 1},
+		{"truncated", jpegHeader(tiffHeader(binary.LittleEndian, 0x0112, 3, 6))[:30], 1},
+		{"jpeg without exif", []byte{0xff, 0xd8, 0xff, 0xda, 0x00, 0x02}, 1},
+		{"png", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"empty", nil, 1},
+	}
+	for _, tt := range tests {
+		if got := exifOrientation(tt.data); got != tt.want {
+			t.Errorf("%s: got orientation %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// The source image holds the pixels a b c / d e f, numbered from 1 to 6.
+	src := image.NewGray(image.Rect(10, 20, 13, 22))
+	for i := 0; i < 6; i++ {
+		src.SetGray(10+i%3, 20+i/3, color.Gray{Y: uint8(i + 1)})
+	}
+	tests := []struct {
+		orientation int
+		want        [][]uint8
+	}{
+		{1, [][]uint8{{1, 2, 3}, {4, 5, 6}}},
+		{2, [][]uint8{{3, 2, 1}, {6, 5, 4}}},
+		{3, [][]uint8{{6, 5, 4}, {3, 2, 1}}},
+		{4, [][]uint8{{4, 5, 6}, {1, 2, 3}}},
+		{5, [][]uint8{{1, 4}, {2, 5}, {3, 6}}},
+		{6, [][]uint8{{4, 1}, {5, 2}, {6, 3}}},
+		{7, [][]uint8{{6, 3}, {5, 2}, {4, 1}}},
+		{8, [][]uint8{{3, 6}, {2, 5}, {1, 4}}},
+		{9, [][]uint8{{1, 2, 3}, {4, 5, 6}}},
+	}
+	for _, tt := range tests {
+		dst := orient(src, tt.orientation)
+		b := dst.Bounds()
+		if b.Dx() != len(tt.want[0]) || b.Dy() != len(tt.want) {
+			t.Errorf("orientation %d: got size %dx%d, want %dx%d", tt.orientation, b.Dx(), b.Dy(), len(tt.want[0]), len(tt.want))
+			continue
+		}
+		for y, row := range tt.want {
+			for x, want := range row {
+				if got := color.GrayModel.Convert(dst.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y; got != want {
+					t.Errorf("orientation %d at %d,%d: got %d, want %d", tt.orientation, x, y, got, want)
+				}
+			}
+		}
+	}
+}
@@ -6,5 +6,5 @@ require (
 	github.com/fogleman/gg v1.3.0
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
 	github.com/lucasb-eyer/go-colorful v1.0.3
-	golang.org/x/image v0.10.0 // indirect
+	golang.org/x/image v0.10.0
 )
@@ -0,0 +1,157 @@
+package palette
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+	"unicode/utf16"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// aseColorEntry is the type of the ASE blocks holding a color. Group blocks are ignored.
+const aseColorEntry = 0x0001
+
+// aseMaxBlock is the largest accepted ASE block, much bigger than a color entry with a long name.
+const aseMaxBlock = 1 << 16
+
+// DecodeACT decodes an Adobe Color Table. The table holds 256 RGB colors,
+// optionally followed by the number of used colors and the transparent color index.
+func DecodeACT(r io.Reader) (Palette, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 768 {
+		return nil, fmt.Errorf("act: invalid file size: %d", len(data))
+	}
+	var (
+		count       = 256
+		transparent = -1
+	)
+	if len(data) >= 772 {
+		count = int(binary.BigEndian.Uint16(data[768:]))
+		if t := binary.BigEndian.Uint16(data[770:]); t != 0xffff {
+			transparent = int(t)
+		}
+		if count == 0 || count > 256 {
+			count = 256
+		}
+	}
+	var p Palette
+	for i := 0; i < count; i++ {
+		if i == transparent {
+			continue
+		}
+		p = append(p, Color{NRGBA: color.NRGBA{R: data[i*3], G: data[i*3+1], B: data[i*3+2], A: 0xff}})
+	}
+	return p, nil
+}
+
+// DecodeASE decodes an Adobe Swatch Exchange file. Group blocks are flattened.
+func DecodeASE(r io.Reader) (Palette, error) {
+	var header struct {
+		Signature [4]byte
+		Major     uint16
+		Minor     uint16
+		Blocks    uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("ase: %v", err)
+	}
+	if string(header.Signature[:]) != "ASEF" {
+		return nil, fmt.Errorf("ase: invalid signature")
+	}
+
+	var p Palette
+	for i := uint32(0); i < header.Blocks; i++ {
+		var block struct {
+			Type   uint16
+			Length uint32
+		}
+		if err := binary.Read(r, binary.BigEndian, &block); err != nil {
+			return nil, fmt.Errorf("ase: %v", err)
+		}
+		if block.Length > aseMaxBlock {
+			return nil, fmt.Errorf("ase: block %d: invalid length: %d", i, block.Length)
+		}
+		data := make([]byte, block.Length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("ase: %v", err)
+		}
+		if block.Type != aseColorEntry {
+			continue
+		}
+		c, err := decodeASEColor(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("ase: block %d: %v", i, err)
+		}
+		p = append(p, c)
+	}
+	return p, nil
+}
+
+// decodeASEColor decodes the content of an ASE color entry block.
+func decodeASEColor(r io.Reader) (Color, error) {
+	var nameLen uint16
+	if err := binary.Read(r, binary.BigEndian, &nameLen); err != nil {
+		return Color{}, err
+	}
+	name := make([]uint16, nameLen)
+	if err := binary.Read(r, binary.BigEndian, name); err != nil {
+		return Color{}, err
+	}
+	// The name is null terminated.
+	if len(name) > 0 && name[len(name)-1] == 0 {
+		name = name[:len(name)-1]
+	}
+
+	var model [4]byte
+	if err := binary.Read(r, binary.BigEndian, &model); err != nil {
+		return Color{}, err
+	}
+	var c colorful.Color
+	switch string(model[:]) {
+	case "RGB ":
+		var v [3]float32
+		if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+			return Color{}, err
+		}
+		c = colorful.Color{R: float64(v[0]), G: float64(v[1]), B: float64(v[2])}
+	case "CMYK":
+		var v [4]float32
+		if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+			return Color{}, err
+		}
+		k := 1 - float64(v[3])
+		c = colorful.Color{R: (1 - float64(v[0])) * k, G: (1 - float64(v[1])) * k, B: (1 - float64(v[2])) * k}
+	case "LAB ":
+		var v [3]float32
+		if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+			return Color{}, err
+		}
+		c = colorful.Lab(float64(v[0]), float64(v[1])/100, float64(v[2])/100)
+	case "Gray":
+		var v float32
+		if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+			return Color{}, err
+		}
+		c = colorful.Color{R: float64(v), G: float64(v), B: float64(v)}
+	default:
+		return Color{}, fmt.Errorf("unsupported color model %q", model[:])
+	}
+	c = c.Clamped()
+	return Color{
+		Name: string(utf16.Decode(name)),
+		NRGBA: color.NRGBA{
+			R: uint8(math.Round(c.R * 255)),
+			G: uint8(math.Round(c.G * 255)),
+			B: uint8(math.Round(c.B * 255)),
+			A: 0xff,
+		},
+	}, nil
+}
@@ -0,0 +1,90 @@
+package palette
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Save saves the palette to a file. The file format is detected from the file extension:
+// .gpl (GIMP), .act (Adobe Color Table), .hex and .csv.
+func Save(path string, p Palette) error {
+	var encode func(io.Writer, Palette) error
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".gpl":
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		encode = func(w io.Writer, p Palette) error { return EncodeGPL(w, p, name) }
+	case ".act":
+		encode = EncodeACT
+	case ".hex":
+		encode = EncodeHex
+	case ".csv":
+		encode = EncodeCSV
+	default:
+		return fmt.Errorf("unsupported palette format: %s", ext)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := encode(f, p); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// EncodeGPL encodes the palette as a GIMP palette.
+func EncodeGPL(w io.Writer, p Palette, name string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "GIMP Palette")
+	if name != "" {
+		fmt.Fprintf(bw, "Name: %s\n", name)
+	}
+	fmt.Fprintln(bw, "#")
+	for _, c := range p {
+		fmt.Fprintf(bw, "%3d %3d %3d\t%s\n", c.R, c.G, c.B, c.Name)
+	}
+	return bw.Flush()
+}
+
+// EncodeHex encodes the palette with one hex color per line.
+func EncodeHex(w io.Writer, p Palette) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range p {
+		fmt.Fprintln(bw, Hex(c.NRGBA)[1:])
+	}
+	return bw.Flush()
+}
+
+// EncodeCSV encodes the palette in CSV format, each record holding the color name and its R, G, B components.
+func EncodeCSV(w io.Writer, p Palette) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"name", "r", "g", "b"})
+	for _, c := range p {
+		cw.Write([]string{c.Name, strconv.Itoa(int(c.R)), strconv.Itoa(int(c.G)), strconv.Itoa(int(c.B))})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// EncodeACT encodes the palette as an Adobe Color Table, holding at most 256 colors.
+func EncodeACT(w io.Writer, p Palette) error {
+	if len(p) > 256 {
+		return fmt.Errorf("act: too many colors: %d", len(p))
+	}
+	data := make([]byte, 772)
+	for i, c := range p {
+		data[i*3], data[i*3+1], data[i*3+2] = c.R, c.G, c.B
+	}
+	binary.BigEndian.PutUint16(data[768:], uint16(len(p)))
+	binary.BigEndian.PutUint16(data[770:], 0xffff)
+	_, err := w.Write(data)
+	return err
+}
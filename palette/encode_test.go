@@ -0,0 +1,70 @@
+package palette
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "palette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := Palette{{Name: "Bright Red", NRGBA: red}, {Name: "Dark Green", NRGBA: green}}
+	tests := []struct {
+		ext string
+		// names tells if the format keeps the color names.
+		names bool
+	}{
+		{".gpl", true},
+		{".csv", true},
+		{".hex", false},
+		{".act", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ext, func(t *testing.T) {
+			path := filepath.Join(dir, "test"+tt.ext)
+			if err := Save(path, p); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := p
+			if !tt.names {
+				want = Palette{{NRGBA: red}, {NRGBA: green}}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+	if err := Save(filepath.Join(dir, "test.ase"), p); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+	if err := EncodeACT(ioutil.Discard, make(Palette, 257)); err == nil {
+		t.Error("expected an error for too many colors")
+	}
+}
+
+func TestLoadEmpty(t *testing.T) {
+	dir, err := ioutil.TempDir("", "palette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "empty.hex")
+	if err := ioutil.WriteFile(path, []byte("\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("expected an error for an empty palette")
+	}
+}
@@ -0,0 +1,229 @@
+// Package palette loads fixed color palettes from the common palette file formats.
+package palette
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Color is a palette color with an optional name.
+type Color struct {
+	Name string
+	// ID is the color identifier used by the exporters, e.g. the LDraw color code.
+	ID string
+	color.NRGBA
+}
+
+// Palette is a list of named colors.
+type Palette []Color
+
+// Load loads a palette file. The file format is detected from the file extension:
+// .gpl (GIMP), .act (Adobe Color Table), .ase (Adobe Swatch Exchange), .hex and .csv.
+func Load(path string) (Palette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var p Palette
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".gpl":
+		p, err = DecodeGPL(f)
+	case ".act":
+		p, err = DecodeACT(f)
+	case ".ase":
+		p, err = DecodeASE(f)
+	case ".hex":
+		p, err = DecodeHex(f)
+	case ".csv":
+		p, err = DecodeCSV(f)
+	default:
+		return nil, fmt.Errorf("unsupported palette format: %s", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return nil, fmt.Errorf("empty palette: %s", path)
+	}
+	return p, nil
+}
+
+// Colors returns the palette as a color.Palette.
+func (p Palette) Colors() color.Palette {
+	cp := make(color.Palette, len(p))
+	for i, c := range p {
+		cp[i] = c.NRGBA
+	}
+	return cp
+}
+
+// Lookup returns the palette color identical with c.
+func (p Palette) Lookup(c color.Color) (Color, bool) {
+	nc := color.NRGBAModel.Convert(c).(color.NRGBA)
+	for _, pc := range p {
+		if pc.NRGBA == nc {
+			return pc, true
+		}
+	}
+	return Color{NRGBA: nc}, false
+}
+
+// Name returns the name of the palette color identical with c, or its hex value if the color is not named.
+func (p Palette) Name(c color.Color) string {
+	nc := color.NRGBAModel.Convert(c).(color.NRGBA)
+	for _, pc := range p {
+		if pc.NRGBA == nc && pc.Name != "" {
+			return pc.Name
+		}
+	}
+	return Hex(nc)
+}
+
+// Names returns the named colors of the palette indexed by their lower case name.
+func (p Palette) Names() map[string]color.Color {
+	names := make(map[string]color.Color)
+	for _, pc := range p {
+		if pc.Name != "" {
+			names[strings.ToLower(pc.Name)] = pc.NRGBA
+		}
+	}
+	return names
+}
+
+// Hex returns the hex representation of a color.
+func Hex(c color.Color) string {
+	nc := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x", nc.R, nc.G, nc.B)
+}
+
+// DecodeGPL decodes a GIMP palette.
+func DecodeGPL(r io.Reader) (Palette, error) {
+	var (
+		p       Palette
+		scanner = bufio.NewScanner(r)
+		line    int
+	)
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if line == 1 {
+			if text != "GIMP Palette" {
+				return nil, fmt.Errorf("gpl: missing GIMP Palette header")
+			}
+			continue
+		}
+		if text == "" || strings.HasPrefix(text, "#") ||
+			strings.HasPrefix(text, "Name:") || strings.HasPrefix(text, "Columns:") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("gpl: line %d: invalid color entry", line)
+		}
+		c, err := parseRGB(fields[:3])
+		if err != nil {
+			return nil, fmt.Errorf("gpl: line %d: %v", line, err)
+		}
+		p = append(p, Color{Name: strings.Join(fields[3:], " "), NRGBA: c})
+	}
+	return p, scanner.Err()
+}
+
+// DecodeHex decodes a palette holding one hex color per line.
+func DecodeHex(r io.Reader) (Palette, error) {
+	var (
+		p       Palette
+		scanner = bufio.NewScanner(r)
+		line    int
+	)
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		c, err := parseHex(text)
+		if err != nil {
+			return nil, fmt.Errorf("hex: line %d: %v", line, err)
+		}
+		p = append(p, Color{NRGBA: c})
+	}
+	return p, scanner.Err()
+}
+
+// DecodeCSV decodes a CSV palette. Each record holds a hex color or the R, G, B components,
+// optionally preceded by the color name. A header record is skipped.
+func DecodeCSV(r io.Reader) (Palette, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var p Palette
+	for i, rec := range records {
+		c, err := parseCSVRecord(rec)
+		if err != nil {
+			// The first record might be a header.
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("csv: record %d: %v", i+1, err)
+		}
+		p = append(p, c)
+	}
+	return p, nil
+}
+
+// parseCSVRecord parses a CSV palette record: hex, name+hex, r+g+b or name+r+g+b.
+func parseCSVRecord(rec []string) (Color, error) {
+	switch len(rec) {
+	case 1:
+		c, err := parseHex(rec[0])
+		return Color{NRGBA: c}, err
+	case 2:
+		c, err := parseHex(rec[1])
+		return Color{Name: rec[0], NRGBA: c}, err
+	case 3:
+		c, err := parseRGB(rec)
+		return Color{NRGBA: c}, err
+	case 4:
+		c, err := parseRGB(rec[1:])
+		return Color{Name: rec[0], NRGBA: c}, err
+	}
+	return Color{}, fmt.Errorf("unexpected number of fields: %d", len(rec))
+}
+
+// parseRGB parses the 8 bit R, G, B components of a color.
+func parseRGB(fields []string) (color.NRGBA, error) {
+	var v [3]uint8
+	for i := range v {
+		n, err := strconv.ParseUint(strings.TrimSpace(fields[i]), 10, 8)
+		if err != nil {
+			return color.NRGBA{}, fmt.Errorf("invalid color component %q", fields[i])
+		}
+		v[i] = uint8(n)
+	}
+	return color.NRGBA{R: v[0], G: v[1], B: v[2], A: 0xff}, nil
+}
+
+// parseHex parses a color in the rrggbb format, with an optional # prefix.
+func parseHex(s string) (color.NRGBA, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	n, err := strconv.ParseUint(s, 16, 32)
+	if err != nil || len(s) != 6 {
+		return color.NRGBA{}, fmt.Errorf("invalid hex color %q", s)
+	}
+	return color.NRGBA{R: uint8(n >> 16), G: uint8(n >> 8), B: uint8(n), A: 0xff}, nil
+}
@@ -0,0 +1,163 @@
+package palette
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+var (
+	red   = color.NRGBA{R: 0xff, A: 0xff}
+	green = color.NRGBA{G: 0x80, A: 0xff}
+)
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode func(io.Reader) (Palette, error)
+		input  string
+		want   Palette
+		err    bool
+	}{
+		{"gpl", DecodeGPL, "GIMP Palette\nName: test\nColumns: 2\n#\n255   0   0\tBright Red\n  0 128   0\n", Palette{{Name: "Bright Red", NRGBA: red}, {NRGBA: green}}, false},
+		{"gpl header", DecodeGPL, "255 0 0\n", nil, true},
+		{"gpl component", DecodeGPL, "GIMP Palette\n256 0 0\n", nil, true},
+		{"gpl entry", DecodeGPL, "GIMP Palette\n255 0\n", nil, true},
+		{"hex", DecodeHex, "ff0000\n\n#008000\n", Palette{{NRGBA: red}, {NRGBA: green}}, false},
+		{"hex short", DecodeHex, "f00\n", nil, true},
+		{"csv", DecodeCSV, "name,r,g,b\nBright Red,255,0,0\n0,128,0\n", Palette{{Name: "Bright Red", NRGBA: red}, {NRGBA: green}}, false},
+		{"csv hex", DecodeCSV, "#ff0000\nGreen, 008000\n", Palette{{NRGBA: red}, {Name: "Green", NRGBA: green}}, false},
+		{"csv invalid", DecodeCSV, "ff0000\nzz0000\n", nil, true},
+		{"csv fields", DecodeCSV, "ff0000\na,1,2,3,4\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.decode(strings.NewReader(tt.input))
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if !tt.err && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeACT(t *testing.T) {
+	table := func(count, transparent uint16) []byte {
+		data := make([]byte, 772)
+		copy(data, []byte{0xff, 0, 0, 0, 0x80, 0})
+		binary.BigEndian.PutUint16(data[768:], count)
+		binary.BigEndian.PutUint16(data[770:], transparent)
+		return data
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want int
+		err  bool
+	}{
+		{"full table", table(0, 0xffff)[:768], 256, false},
+		{"count", table(2, 0xffff), 2, false},
+		{"transparent", table(2, 1), 1, false},
+		{"invalid count", table(300, 0xffff), 256, false},
+		{"truncated", make([]byte, 100), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := DecodeACT(bytes.NewReader(tt.data))
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if len(p) != tt.want {
+				t.Fatalf("got %d colors, want %d", len(p), tt.want)
+			}
+			if len(p) > 0 && p[0].NRGBA != red {
+				t.Errorf("got first color %v, want %v", p[0].NRGBA, red)
+			}
+		})
+	}
+}
+
+// aseBlock encodes an ASE color entry block.
+func aseBlock(name, model string, values ...float32) []byte {
+	var body bytes.Buffer
+	runes := append(utf16.Encode([]rune(name)), 0)
+	binary.Write(&body, binary.BigEndian, uint16(len(runes)))
+	binary.Write(&body, binary.BigEndian, runes)
+	body.WriteString(model)
+	binary.Write(&body, binary.BigEndian, values)
+	binary.Write(&body, binary.BigEndian, uint16(2))
+
+	var block bytes.Buffer
+	binary.Write(&block, binary.BigEndian, uint16(aseColorEntry))
+	binary.Write(&block, binary.BigEndian, uint32(body.Len()))
+	block.Write(body.Bytes())
+	return block.Bytes()
+}
+
+func TestDecodeASE(t *testing.T) {
+	blocks := [][]byte{
+		aseBlock("Red", "RGB ", 1, 0, 0),
+		// A group start block, ignored.
+		{0xc0, 0x01, 0, 0, 0, 0},
+		aseBlock("Black", "CMYK", 0, 0, 0, 1),
+		aseBlock("Gray", "Gray", 0.5),
+		aseBlock("White", "LAB ", 100, 0, 0),
+	}
+	var data bytes.Buffer
+	data.WriteString("ASEF")
+	binary.Write(&data, binary.BigEndian, []uint16{1, 0})
+	binary.Write(&data, binary.BigEndian, uint32(len(blocks)))
+	for _, b := range blocks {
+		data.Write(b)
+	}
+
+	p, err := DecodeASE(bytes.NewReader(data.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Palette{
+		{Name: "Red", NRGBA: red},
+		{Name: "Black", NRGBA: color.NRGBA{A: 0xff}},
+		{Name: "Gray", NRGBA: color.NRGBA{R: 0x80, G: 0x80, B: 0x80, A: 0xff}},
+		{Name: "White", NRGBA: color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}},
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("got %v, want %v", p, want)
+	}
+
+	if _, err := DecodeASE(strings.NewReader("ASEX\x00\x01\x00\x00\x00\x00\x00\x00")); err == nil {
+		t.Error("expected an error for an invalid signature")
+	}
+	if _, err := DecodeASE(bytes.NewReader(data.Bytes()[:30])); err == nil {
+		t.Error("expected an error for a truncated file")
+	}
+	if _, err := DecodeASE(bytes.NewReader(append(data.Bytes()[:16:16], aseBlock("x", "HSV ", 0, 0, 0)...))); err == nil {
+		t.Error("expected an error for an unsupported color model")
+	}
+	if _, err := DecodeASE(bytes.NewReader(append(data.Bytes()[:12:12], 0, 1, 0xff, 0xff, 0xff, 0xff))); err == nil {
+		t.Error("expected an error for a corrupt block length")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	p := Palette{{Name: "Bright Red", ID: "4", NRGBA: red}, {NRGBA: green}}
+	if c, ok := p.Lookup(color.RGBA{R: 0xff, A: 0xff}); !ok || c.ID != "4" {
+		t.Errorf("got %v, %v, want the Bright Red color", c, ok)
+	}
+	if _, ok := p.Lookup(color.NRGBA{R: 0xfe, A: 0xff}); ok {
+		t.Error("expected no color for an approximate match")
+	}
+	if name := p.Name(green); name != "#008000" {
+		t.Errorf("got name %q, want the hex value", name)
+	}
+	if c := p.Names()["bright red"]; c != red {
+		t.Errorf("got %v for the lower case name, want %v", c, red)
+	}
+}
@@ -0,0 +1,318 @@
+package quantizer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// Filter is an image adjustment applied on the source image before quantization.
+type Filter interface {
+	Apply(image.Image) *image.NRGBA
+}
+
+// Pipeline is a list of filters applied in order.
+type Pipeline []Filter
+
+// Brightness shifts the brightness of the image. The value should be in the [-1, 1] range.
+type Brightness float64
+
+// Contrast changes the contrast of the image. The value should be in the [-1, 1] range,
+// the values above MaxContrast being clamped.
+type Contrast float64
+
+// MaxContrast is the strongest contrast adjustment. A contrast of 1 would have an infinite slope.
+const MaxContrast = 0.99
+
+// Gamma applies a gamma correction on the image. Values above 1 brighten, values below 1 darken the image.
+type Gamma float64
+
+// Saturation changes the color saturation of the image. The value should be in the [-1, 1] range,
+// -1 resulting in a grayscale image.
+type Saturation float64
+
+// HueShift rotates the hue of each pixel with the provided angle in degrees.
+type HueShift float64
+
+// AutoLevels stretches each color channel to cover the full value range.
+type AutoLevels struct {
+	// Clip is the fraction of darkest and brightest pixels ignored when computing the channel range.
+	Clip float64
+}
+
+// Equalize spreads the image luminance by equalizing the luminance histogram.
+type Equalize struct{}
+
+// UnsharpMask enhances the image details by adding back the difference between the image and its blurred version.
+type UnsharpMask struct {
+	// Radius is the standard deviation of the gaussian blur, in pixels.
+	Radius float64
+	// Amount is the strength of the sharpening.
+	Amount float64
+}
+
+// Apply runs the image through all the filters of the pipeline.
+func (p Pipeline) Apply(img image.Image) *image.NRGBA {
+	dst := toNRGBA(img)
+	for _, f := range p {
+		dst = f.Apply(dst)
+	}
+	return dst
+}
+
+// Apply implements the Filter interface.
+func (b Brightness) Apply(img image.Image) *image.NRGBA {
+	return applyLUT(img, newLUT(func(v float64) float64 {
+		return v + float64(b)
+	}))
+}
+
+// Apply implements the Filter interface.
+func (c Contrast) Apply(img image.Image) *image.NRGBA {
+	v := math.Max(-1, math.Min(MaxContrast, float64(c)))
+	factor := math.Tan((v + 1) * math.Pi / 4)
+	return applyLUT(img, newLUT(func(v float64) float64 {
+		return (v-0.5)*factor + 0.5
+	}))
+}
+
+// Apply implements the Filter interface.
+func (g Gamma) Apply(img image.Image) *image.NRGBA {
+	if g <= 0 {
+		return toNRGBA(img)
+	}
+	return applyLUT(img, newLUT(func(v float64) float64 {
+		return math.Pow(v, 1/float64(g))
+	}))
+}
+
+// Apply implements the Filter interface.
+func (s Saturation) Apply(img image.Image) *image.NRGBA {
+	return applyHsl(img, func(h, sat, l float64) (float64, float64, float64) {
+		return h, sat * (1 + float64(s)), l
+	})
+}
+
+// Apply implements the Filter interface.
+func (hs HueShift) Apply(img image.Image) *image.NRGBA {
+	return applyHsl(img, func(h, s, l float64) (float64, float64, float64) {
+		return math.Mod(math.Mod(h+float64(hs), 360)+360, 360), s, l
+	})
+}
+
+// Apply implements the Filter interface.
+func (al AutoLevels) Apply(img image.Image) *image.NRGBA {
+	dst := toNRGBA(img)
+
+	var hist [3][256]int
+	total := eachOpaquePixel(dst, func(pix []uint8) {
+		for c := 0; c < 3; c++ {
+			hist[c][pix[c]]++
+		}
+	})
+	if total == 0 {
+		return dst
+	}
+	clip := int(al.Clip * float64(total))
+
+	var luts [3][256]uint8
+	for c := 0; c < 3; c++ {
+		lo, hi := 0, 255
+		for sum := 0; lo < 255; lo++ {
+			if sum += hist[c][lo]; sum > clip {
+				break
+			}
+		}
+		for sum := 0; hi > 0; hi-- {
+			if sum += hist[c][hi]; sum > clip {
+				break
+			}
+		}
+		if hi <= lo {
+			for v := range luts[c] {
+				luts[c][v] = uint8(v)
+			}
+			continue
+		}
+		luts[c] = newLUT(func(v float64) float64 {
+			return (v*255 - float64(lo)) / float64(hi-lo)
+		})
+	}
+	eachOpaquePixel(dst, func(pix []uint8) {
+		for c := 0; c < 3; c++ {
+			pix[c] = luts[c][pix[c]]
+		}
+	})
+	return dst
+}
+
+// Apply implements the Filter interface.
+func (Equalize) Apply(img image.Image) *image.NRGBA {
+	dst := toNRGBA(img)
+
+	var hist [256]int
+	total := eachOpaquePixel(dst, func(pix []uint8) {
+		y, _, _ := color.RGBToYCbCr(pix[0], pix[1], pix[2])
+		hist[y]++
+	})
+	if total == 0 {
+		return dst
+	}
+	// Build the cumulative distribution function of the luminance.
+	var (
+		cdf    [256]int
+		cdfMin int
+		lut    [256]uint8
+	)
+	for i, sum := 0, 0; i < 256; i++ {
+		sum += hist[i]
+		cdf[i] = sum
+		if cdfMin == 0 {
+			cdfMin = sum
+		}
+	}
+	if total == cdfMin {
+		return dst
+	}
+	for i := range lut {
+		lut[i] = uint8(math.Round(math.Max(0, float64(cdf[i]-cdfMin)) / float64(total-cdfMin) * 255))
+	}
+	eachOpaquePixel(dst, func(pix []uint8) {
+		y, cb, cr := color.RGBToYCbCr(pix[0], pix[1], pix[2])
+		pix[0], pix[1], pix[2] = color.YCbCrToRGB(lut[y], cb, cr)
+	})
+	return dst
+}
+
+// Apply implements the Filter interface.
+func (um UnsharpMask) Apply(img image.Image) *image.NRGBA {
+	dst := toNRGBA(img)
+	if um.Radius <= 0 || um.Amount == 0 {
+		return dst
+	}
+	blurred := gaussianBlur(dst, um.Radius)
+	for i := 0; i < len(dst.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			v := float64(dst.Pix[i+c])
+			v += (v - float64(blurred.Pix[i+c])) * um.Amount
+			dst.Pix[i+c] = uint8(math.Round(math.Max(0, math.Min(255, v))))
+		}
+	}
+	return dst
+}
+
+// gaussianBlur returns a blurred copy of the image using a separable gaussian kernel.
+func gaussianBlur(img *image.NRGBA, sigma float64) *image.NRGBA {
+	var (
+		radius = int(math.Ceil(sigma * 3))
+		kernel = make([]float64, 2*radius+1)
+		sum    float64
+	)
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+
+	bounds := img.Bounds()
+	blur := func(src *image.NRGBA, dx, dy int) *image.NRGBA {
+		dst := image.NewNRGBA(bounds)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				var acc [4]float64
+				for k, w := range kernel {
+					// Clamp the sampled pixel to the image edges.
+					sx := clampInt(x+(k-radius)*dx, bounds.Min.X, bounds.Max.X-1)
+					sy := clampInt(y+(k-radius)*dy, bounds.Min.Y, bounds.Max.Y-1)
+					si := src.PixOffset(sx, sy)
+					for c := range acc {
+						acc[c] += float64(src.Pix[si+c]) * w
+					}
+				}
+				di := dst.PixOffset(x, y)
+				for c := range acc {
+					dst.Pix[di+c] = uint8(math.Round(acc[c]))
+				}
+			}
+		}
+		return dst
+	}
+	return blur(blur(img, 1, 0), 0, 1)
+}
+
+// toNRGBA returns a copy of the image as *image.NRGBA.
+func toNRGBA(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(bounds)
+	draw.Draw(dst, bounds, img, bounds.Min, draw.Src)
+	return dst
+}
+
+// eachOpaquePixel calls fn with the pixel buffer of every non transparent pixel.
+// Returns the number of visited pixels.
+func eachOpaquePixel(img *image.NRGBA, fn func(pix []uint8)) int {
+	var (
+		bounds = img.Bounds()
+		n      int
+	)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			i := img.PixOffset(x, y)
+			pix := img.Pix[i : i+4 : i+4]
+			if pix[3] == 0 {
+				continue
+			}
+			fn(pix)
+			n++
+		}
+	}
+	return n
+}
+
+// newLUT builds an 8 bit lookup table from a function operating on normalized values.
+func newLUT(fn func(float64) float64) [256]uint8 {
+	var lut [256]uint8
+	for i := range lut {
+		v := fn(float64(i) / 255)
+		lut[i] = uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+	}
+	return lut
+}
+
+// applyLUT maps each color channel of the image through the lookup table.
+func applyLUT(img image.Image, lut [256]uint8) *image.NRGBA {
+	dst := toNRGBA(img)
+	eachOpaquePixel(dst, func(pix []uint8) {
+		pix[0], pix[1], pix[2] = lut[pix[0]], lut[pix[1]], lut[pix[2]]
+	})
+	return dst
+}
+
+// applyHsl maps each pixel of the image through a function operating in the HSL color space.
+func applyHsl(img image.Image, fn func(h, s, l float64) (float64, float64, float64)) *image.NRGBA {
+	dst := toNRGBA(img)
+	eachOpaquePixel(dst, func(pix []uint8) {
+		c := colorful.Color{R: float64(pix[0]) / 255, G: float64(pix[1]) / 255, B: float64(pix[2]) / 255}
+		h, s, l := c.Hsl()
+		h, s, l = fn(h, s, l)
+		pix[0], pix[1], pix[2] = colorful.Hsl(h, math.Max(0, math.Min(1, s)), l).Clamped().RGB255()
+	})
+	return dst
+}
+
+// clampInt restricts the value to the [lo, hi] range.
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,48 @@
+package quantizer
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestContrast(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 0x40, G: 0x40, B: 0x40, A: 0xff})
+	img.SetNRGBA(1, 0, color.NRGBA{R: 0xc0, G: 0xc0, B: 0xc0, A: 0xff})
+
+	tests := []struct {
+		contrast float64
+		want     [2]uint8
+	}{
+		{0, [2]uint8{0x40, 0xc0}},
+		{-1, [2]uint8{0x80, 0x80}},
+		{1, [2]uint8{0x00, 0xff}},
+		{5, [2]uint8{0x00, 0xff}},
+	}
+	for _, tt := range tests {
+		dst := Contrast(tt.contrast).Apply(img)
+		for x, want := range tt.want {
+			if got := dst.NRGBAAt(x, 0).R; got != want {
+				t.Errorf("contrast %v at %d: got %#x, want %#x", tt.contrast, x, got, want)
+			}
+		}
+	}
+}
+
+func TestChromaKeyFill(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(1, 0, color.NRGBA{R: 0x10, A: 0xff})
+
+	bg := color.NRGBA{G: 0xff, A: 0xff}
+	dst := ChromaKey{Replace: bg}.Fill(img)
+	if got := dst.NRGBAAt(0, 0); got != bg {
+		t.Errorf("got transparent pixel %v, want %v", got, bg)
+	}
+	if got := dst.NRGBAAt(1, 0); got != img.NRGBAAt(1, 0) {
+		t.Errorf("got opaque pixel %v, want it unchanged", got)
+	}
+	if got := (ChromaKey{}).Fill(img).NRGBAAt(0, 0); got.A != 0 {
+		t.Errorf("got %v without replacement color, want a transparent pixel", got)
+	}
+}
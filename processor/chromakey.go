@@ -0,0 +1,151 @@
+package quantizer
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// ChromaKey removes the background of an image before quantization.
+// A pixel is considered background when its color is within the tolerance of the key color.
+type ChromaKey struct {
+	// Key is the background color. When nil, the most frequent border color is used as key.
+	Key color.Color
+	// FloodFill removes only the background pixels connected to the image borders,
+	// otherwise every pixel matching the key color is removed.
+	FloodFill bool
+	// Tolerance is the maximum ΔE (CIE76) distance between a pixel and the key color.
+	Tolerance float64
+	// Replace is the color used in place of the removed background. When nil the background becomes transparent,
+	// in which case the quantizer AlphaThreshold should be set to leave the background cells empty.
+	Replace color.Color
+}
+
+// Apply returns a copy of the source image with the background removed.
+func (ck ChromaKey) Apply(img image.Image) *image.NRGBA {
+	var (
+		bounds = img.Bounds()
+		dst    = toNRGBA(img)
+		key    = ck.Key
+	)
+	if bounds.Empty() {
+		return dst
+	}
+	if key == nil {
+		key = borderColor(dst)
+	}
+	kc, _ := colorful.MakeColor(opaque(key))
+
+	replace := color.NRGBA{}
+	if ck.Replace != nil {
+		replace = color.NRGBAModel.Convert(ck.Replace).(color.NRGBA)
+	}
+	isBackground := func(x, y int) bool {
+		c := dst.NRGBAAt(x, y)
+		if c.A == 0 {
+			return true
+		}
+		pc := colorful.Color{R: float64(c.R) / 255, G: float64(c.G) / 255, B: float64(c.B) / 255}
+		return pc.DistanceCIE76(kc)*100 <= ck.Tolerance
+	}
+
+	if !ck.FloodFill {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if isBackground(x, y) {
+					dst.SetNRGBA(x, y, replace)
+				}
+			}
+		}
+		return dst
+	}
+
+	// Flood fill the background starting from the border pixels.
+	var (
+		visited = make([]bool, bounds.Dx()*bounds.Dy())
+		stack   []image.Point
+	)
+	push := func(x, y int) {
+		if !(image.Point{x, y}).In(bounds) {
+			return
+		}
+		i := (y-bounds.Min.Y)*bounds.Dx() + (x - bounds.Min.X)
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		if isBackground(x, y) {
+			stack = append(stack, image.Point{x, y})
+		}
+	}
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		push(x, bounds.Min.Y)
+		push(x, bounds.Max.Y-1)
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		push(bounds.Min.X, y)
+		push(bounds.Max.X-1, y)
+	}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		push(p.X-1, p.Y)
+		push(p.X+1, p.Y)
+		push(p.X, p.Y-1)
+		push(p.X, p.Y+1)
+		dst.SetNRGBA(p.X, p.Y, replace)
+	}
+	return dst
+}
+
+// Fill returns a copy of the image with the transparent pixels set to the replacement color.
+// It completes a key applied without replacement color, so the image can be processed in between.
+func (ck ChromaKey) Fill(img image.Image) *image.NRGBA {
+	dst := toNRGBA(img)
+	if ck.Replace == nil {
+		return dst
+	}
+	replace := color.NRGBAModel.Convert(ck.Replace).(color.NRGBA)
+	bounds := dst.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if dst.NRGBAAt(x, y).A == 0 {
+				dst.SetNRGBA(x, y, replace)
+			}
+		}
+	}
+	return dst
+}
+
+// borderColor returns the most frequent color found on the image borders.
+func borderColor(img *image.NRGBA) color.Color {
+	var (
+		bounds = img.Bounds()
+		hist   = make(map[color.NRGBA]int)
+		best   color.NRGBA
+	)
+	add := func(x, y int) {
+		c := img.NRGBAAt(x, y)
+		hist[c]++
+		if hist[c] > hist[best] {
+			best = c
+		}
+	}
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		add(x, bounds.Min.Y)
+		add(x, bounds.Max.Y-1)
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		add(bounds.Min.X, y)
+		add(bounds.Max.X-1, y)
+	}
+	return best
+}
+
+// opaque drops the alpha channel of a color.
+func opaque(c color.Color) color.Color {
+	nc := color.NRGBAModel.Convert(c).(color.NRGBA)
+	nc.A = 0xff
+	return nc
+}
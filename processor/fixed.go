@@ -0,0 +1,72 @@
+package quantizer
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// mapToPalette maps the colors of the paletted image to their perceptually closest colors from the fixed palette.
+// The returned image palette holds only the used fixed palette colors, so it never holds more colors than the source.
+func mapToPalette(pi *image.Paletted, fixed color.Palette) *image.Paletted {
+	var (
+		lab     = labPalette(fixed)
+		palette color.Palette
+		used    = make(map[int]uint8)
+		table   = make([]uint8, len(pi.Palette))
+	)
+	for i, c := range pi.Palette {
+		if _, _, _, a := c.RGBA(); a != 0xffff {
+			// Keep the transparent entries as they are.
+			table[i] = uint8(len(palette))
+			palette = append(palette, c)
+			continue
+		}
+		fi := nearestLab(lab, c)
+		idx, ok := used[fi]
+		if !ok {
+			idx = uint8(len(palette))
+			used[fi] = idx
+			palette = append(palette, fixed[fi])
+		}
+		table[i] = idx
+	}
+	for i, v := range pi.Pix {
+		pi.Pix[i] = table[v]
+	}
+	pi.Palette = palette
+	return pi
+}
+
+// labPalette converts the palette colors into the CIE L*a*b* color space.
+func labPalette(p color.Palette) []colorful.Color {
+	lab := make([]colorful.Color, len(p))
+	for i, c := range p {
+		cc, _ := colorful.MakeColor(opaque(c))
+		l, a, b := cc.Lab()
+		lab[i] = colorful.Color{R: l, G: a, B: b}
+	}
+	return lab
+}
+
+// nearestLab returns the index of the palette color closest to c in the CIE L*a*b* color space.
+// The palette is expected to be converted with labPalette.
+func nearestLab(lab []colorful.Color, c color.Color) int {
+	cc, _ := colorful.MakeColor(opaque(c))
+	l, a, b := cc.Lab()
+
+	best, bestDist := 0, -1.0
+	for i, pc := range lab {
+		d := sq(pc.R-l) + sq(pc.G-a) + sq(pc.B-b)
+		if bestDist < 0 || d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+// sq returns the square of a number.
+func sq(v float64) float64 {
+	return v * v
+}
@@ -17,7 +17,11 @@ type Quantizer interface {
 // Image quantization method. Returns a paletted image.
 // We need to use type assertion to match the interface returning type.
 func (q Quant) Quantize(img image.Image, nq int) image.Image {
-	qz := newQuantizer(img, nq) 		// set up a work space
+	if len(q.Palette) > 0 {
+		return q.quantizeFixed(img, nq)	// select the best colors of the fixed palette
+	}
+	qz := newQuantizer(img, nq, q.AlphaThreshold) 	// set up a work space
+	qz.Weights = q.Weights
 	qz.cluster()				// cluster pixels by color
 	return qz.Paletted().(image.Image)	// generate paletted image from clusters
 }
@@ -29,12 +33,26 @@ type Quant struct {
 	px  []point     // list of all points in the image
 	ch  chValues    // buffer for computing median
 	eq  []point     // additional buffer used when splitting cluster
+
+	// AlphaThreshold is the alpha value below which a pixel is considered transparent.
+	// Transparent pixels are excluded from clustering and mapped to a transparent palette entry.
+	AlphaThreshold uint8
+	transparent    []point // list of transparent points
+
+	// Weights is an optional weight map defining the importance of each pixel.
+	// Clusters holding important pixels are split first and their colors are biased toward these pixels.
+	Weights *image.Gray
+
+	// Palette is an optional fixed palette. When provided the image is quantized with the subset of palette colors
+	// minimizing the perceptual error, the number of colors being the maximum number of palette colors used.
+	Palette color.Palette
 }
 
 type cluster struct {
 	px       []point // list of points in the cluster
 	widestCh int     // rx, gx, bx const for channel with widest value range
 	chRange  uint32  // value range (vmax-vmin) of widest channel
+	weight   float64 // sum of the pixel weights
 }
 
 type point struct{ x, y int }
@@ -47,30 +65,53 @@ const (
 	bx
 )
 
-func newQuantizer(img image.Image, nq int) *Quant {
+func newQuantizer(img image.Image, nq int, at uint8) *Quant {
 	b := img.Bounds()
 	npx := (b.Max.X - b.Min.X) * (b.Max.Y - b.Min.Y)
 	// Create work space.
 	qz := &Quant{
-		img: img,
-		ch:  make(chValues, npx),
-		cs:  make([]cluster, nq),
+		img:            img,
+		ch:             make(chValues, npx),
+		AlphaThreshold: at,
 	}
-	// Populate initial cluster with all pixels from image.
-	c := &qz.cs[0]
-	px := make([]point, npx)
-	c.px = px
-	i := 0
+	// Populate initial cluster with all the opaque pixels from image.
+	px := make([]point, 0, npx)
 	for y := b.Min.Y; y < b.Max.Y; y++ {
 		for x := b.Min.X; x < b.Max.X; x++ {
-			px[i].x = x
-			px[i].y = y
-			i++
+			if !qz.isOpaque(x, y) {
+				qz.transparent = append(qz.transparent, point{x, y})
+				continue
+			}
+			px = append(px, point{x, y})
 		}
 	}
+	// Reserve a palette entry for the transparent color.
+	if len(qz.transparent) > 0 && nq > 255 {
+		nq = 255
+	}
+	qz.cs = make([]cluster, nq)
+	qz.cs[0].px = px
 	return qz
 }
 
+// isOpaque checks if the pixel alpha value is above the alpha threshold.
+func (q *Quant) isOpaque(x, y int) bool {
+	if q.AlphaThreshold == 0 {
+		return true
+	}
+	_, _, _, a := q.img.At(x, y).RGBA()
+	return a>>8 >= uint32(q.AlphaThreshold)
+}
+
+// rgb returns the non alpha-premultiplied color values of the pixel.
+func (q *Quant) rgb(p point) (r, g, b uint32) {
+	r, g, b, a := q.img.At(p.x, p.y).RGBA()
+	if a == 0xffff || a == 0 {
+		return r, g, b
+	}
+	return r * 0xffff / a, g * 0xffff / a, b * 0xffff / a
+}
+
 func (qz *Quant) cluster() {
 	// Cluster by repeatedly splitting clusters.
 	// Use a heap as priority queue for picking clusters to split.
@@ -80,6 +121,11 @@ func (qz *Quant) cluster() {
 	pq := new(queue)
 	// Initial cluster.  populated at this point, but not analyzed.
 	c := &qz.cs[0]
+	// Nothing to cluster if the image is fully transparent.
+	if len(c.px) == 0 {
+		qz.cs = qz.cs[:0]
+		return
+	}
 	for i := 1; ; {
 		qz.setColorRange(c)
 		// Cluster cannot be split if all pixels are the same color.
@@ -115,8 +161,10 @@ func (q *Quant) setColorRange(c *cluster) {
 	minR := uint32(math.MaxUint32)
 	minG := uint32(math.MaxUint32)
 	minB := uint32(math.MaxUint32)
+	c.weight = 0
 	for _, p := range c.px {
-		r, g, b, _ := q.img.At(p.x, p.y).RGBA()
+		c.weight += q.weight(p)
+		r, g, b := q.rgb(p)
 		if r < minR {
 			minR = r
 		}
@@ -161,15 +209,15 @@ func (q *Quant) Median(c *cluster) uint32 {
 	switch c.widestCh {
 	case rx:
 		for i, p := range c.px {
-			ch[i], _, _, _ = q.img.At(p.x, p.y).RGBA()
+			ch[i], _, _ = q.rgb(p)
 		}
 	case gx:
 		for i, p := range c.px {
-			_, ch[i], _, _ = q.img.At(p.x, p.y).RGBA()
+			_, ch[i], _ = q.rgb(p)
 		}
 	case bx:
 		for i, p := range c.px {
-			_, _, ch[i], _ = q.img.At(p.x, p.y).RGBA()
+			_, _, ch[i] = q.rgb(p)
 		}
 	}
 	// Median algorithm.
@@ -191,7 +239,7 @@ func (q *Quant) Split(s, c *cluster, m uint32) {
 	eq := q.eq[:0] // reuse any existing buffer
 	for i <= gt {
 		// Get pixel value of appropriate channel.
-		r, g, b, _ := q.img.At(px[i].x, px[i].y).RGBA()
+		r, g, b := q.rgb(px[i])
 		switch s.widestCh {
 		case rx:
 			v = r
@@ -231,23 +279,31 @@ func (q *Quant) Split(s, c *cluster, m uint32) {
 }
 
 func (qz *Quant) Paletted() image.PalettedImage {
-	cp := make(color.Palette, len(qz.cs))
+	cp := make(color.Palette, len(qz.cs), len(qz.cs)+1)
+	// The transparent pixels are mapped to the last palette entry.
+	if len(qz.transparent) > 0 {
+		cp = append(cp, color.Transparent)
+	}
 	pi := image.NewPaletted(qz.img.Bounds(), cp)
+	for _, p := range qz.transparent {
+		pi.SetColorIndex(p.x, p.y, uint8(len(cp)-1))
+	}
 	for i := range qz.cs {
 		px := qz.cs[i].px
-		// Average values in cluster to get palette color.
-		var rsum, gsum, bsum int64
+		// Weighted average of the values in cluster to get palette color.
+		var rsum, gsum, bsum, wsum float64
 		for _, p := range px {
-			r, g, b, _ := qz.img.At(p.x, p.y).RGBA()
-			rsum += int64(r)
-			gsum += int64(g)
-			bsum += int64(b)
+			r, g, b := qz.rgb(p)
+			w := qz.weight(p)
+			rsum += float64(r) * w
+			gsum += float64(g) * w
+			bsum += float64(b) * w
+			wsum += w
 		}
-		n64 := int64(len(px))
 		cp[i] = color.NRGBA64{
-			uint16(rsum / n64),
-			uint16(gsum / n64),
-			uint16(bsum / n64),
+			uint16(rsum / wsum),
+			uint16(gsum / wsum),
+			uint16(bsum / wsum),
 			0xffff,
 		}
 		// set image pixels
@@ -266,9 +322,9 @@ func (c chValues) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
 // Implement heap.Interface for priority queue of clusters.
 func (q queue) Len() int { return len(q) }
 
-// Less implements rule to select cluster with greatest number of pixels.
+// Less implements rule to select cluster with greatest number of (weighted) pixels.
 func (q queue) Less(i, j int) bool {
-	return len(q[j].px) < len(q[i].px)
+	return q[j].weight < q[i].weight
 }
 
 func (q queue) Swap(i, j int) {
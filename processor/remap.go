@@ -0,0 +1,139 @@
+package quantizer
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"os"
+	"strings"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"golang.org/x/image/colornames"
+)
+
+// Remap is a list of color substitutions applied on the quantized palette.
+type Remap []Substitution
+
+// Substitution replaces the palette color closest to From with the To color.
+type Substitution struct {
+	From, To color.Color
+}
+
+// remapSeparators are the accepted separators between the source and the target color of a remap rule.
+var remapSeparators = []string{"→", "->", "=>", "="}
+
+// LoadRemap loads the color remap table from a text file.
+// Each line holds a rule in the "old -> new" form, where the colors are defined either
+// in hex format or by their name. The names are looked up first in the provided palette names
+// (indexed by their lower case name), then in the SVG 1.1 color names.
+// Empty lines and lines starting with "//" are ignored.
+func LoadRemap(path string, names map[string]color.Color) (Remap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		remap   Remap
+		scanner = bufio.NewScanner(f)
+		line    int
+	)
+	for scanner.Scan() {
+		line++
+		rule := strings.TrimSpace(scanner.Text())
+		if rule == "" || strings.HasPrefix(rule, "//") {
+			continue
+		}
+		var parts []string
+		for _, sep := range remapSeparators {
+			if parts = strings.SplitN(rule, sep, 2); len(parts) == 2 {
+				break
+			}
+		}
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: invalid remap rule %q", line, rule)
+		}
+		parse := func(s string) (color.Color, error) {
+			if c, ok := names[strings.ToLower(strings.TrimSpace(s))]; ok {
+				return c, nil
+			}
+			return ParseColor(s)
+		}
+		from, err := parse(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		to, err := parse(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		remap = append(remap, Substitution{From: from, To: to})
+	}
+	return remap, scanner.Err()
+}
+
+// ParseColor parses a color defined in hex format (#rrggbb or #rgb) or by its SVG 1.1 color name.
+func ParseColor(s string) (color.Color, error) {
+	s = strings.TrimSpace(s)
+	if c, ok := colornames.Map[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+	if !strings.HasPrefix(s, "#") {
+		s = "#" + s
+	}
+	c, err := colorful.Hex(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	r, g, b := c.RGB255()
+	return color.NRGBA{R: r, G: g, B: b, A: 0xff}, nil
+}
+
+// RemapTolerance is the largest RGB distance, in 8-bit units, between a palette color
+// and the source color of a rule matching it.
+const RemapTolerance = 16
+
+// Apply returns a copy of the palette with the substitutions applied,
+// together with the list of effectively replaced palette colors and the rules which matched no color.
+// Each rule replaces the opaque palette color closest to its source color, provided that
+// it lies within RemapTolerance, the rules being matched against the original palette.
+func (r Remap) Apply(p color.Palette) (color.Palette, []Substitution, Remap) {
+	var (
+		remapped  = append(color.Palette(nil), p...)
+		applied   []Substitution
+		unmatched Remap
+	)
+	for _, s := range r {
+		best, bestDist := -1, uint32(RemapTolerance*RemapTolerance+1)
+		for i, c := range p {
+			if _, _, _, a := c.RGBA(); a != 0xffff {
+				continue
+			}
+			if d := sqDiff(c, s.From); d < bestDist {
+				best, bestDist = i, d
+			}
+		}
+		if best < 0 {
+			unmatched = append(unmatched, s)
+			continue
+		}
+		remapped[best] = s.To
+		applied = append(applied, Substitution{From: p[best], To: s.To})
+	}
+	return remapped, applied, unmatched
+}
+
+// sqDiff returns the squared euclidean distance between two colors in the 8-bit RGB space.
+func sqDiff(c1, c2 color.Color) uint32 {
+	r1, g1, b1, _ := c1.RGBA()
+	r2, g2, b2, _ := c2.RGBA()
+	diff := func(x, y uint32) uint32 {
+		if x > y {
+			x, y = y, x
+		}
+		d := (y - x) >> 8
+		return d * d
+	}
+	return diff(r1, r2) + diff(g1, g2) + diff(b1, b2)
+}
@@ -0,0 +1,83 @@
+package quantizer
+
+import (
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadRemap(t *testing.T) {
+	names := map[string]color.Color{"bright red": color.NRGBA{R: 0xc9, G: 0x1a, B: 0x09, A: 0xff}}
+	tests := []struct {
+		name  string
+		input string
+		want  Remap
+		err   bool
+	}{
+		{"hex", "#ff0000 -> #00f\n", Remap{{color.NRGBA{R: 0xff, A: 0xff}, color.NRGBA{B: 0xff, A: 0xff}}}, false},
+		{"separators", "// comment\n\nff0000 → blue\nBright Red = white\n", Remap{
+			{color.NRGBA{R: 0xff, A: 0xff}, color.RGBA{B: 0xff, A: 0xff}},
+			{names["bright red"], color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}},
+		}, false},
+		{"missing separator", "#ff0000 #0000ff\n", nil, true},
+		{"invalid color", "#ff00 -> nocolor\n", nil, true},
+	}
+	dir, err := ioutil.TempDir("", "legoizer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, string(rune('a'+i))+".txt")
+			if err := ioutil.WriteFile(path, []byte(tt.input), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadRemap(path, names)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if !tt.err && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemapApply(t *testing.T) {
+	var (
+		red   = color.NRGBA{R: 0xff, A: 0xff}
+		green = color.NRGBA{G: 0xff, A: 0xff}
+		blue  = color.NRGBA{B: 0xff, A: 0xff}
+		white = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	)
+	p := color.Palette{color.NRGBA{}, red, green}
+	tests := []struct {
+		name      string
+		remap     Remap
+		want      color.Palette
+		applied   int
+		unmatched int
+	}{
+		{"exact", Remap{{red, blue}}, color.Palette{color.NRGBA{}, blue, green}, 1, 0},
+		{"within tolerance", Remap{{color.NRGBA{R: 0xf8, G: 0x08, A: 0xff}, blue}}, color.Palette{color.NRGBA{}, blue, green}, 1, 0},
+		{"too far", Remap{{color.NRGBA{R: 0x80, A: 0xff}, blue}}, p, 0, 1},
+		{"transparent skipped", Remap{{color.NRGBA{}, white}}, p, 0, 1},
+		{"original palette", Remap{{red, green}, {green, red}}, color.Palette{color.NRGBA{}, green, red}, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, applied, unmatched := tt.remap.Apply(p)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got palette %v, want %v", got, tt.want)
+			}
+			if len(applied) != tt.applied || len(unmatched) != tt.unmatched {
+				t.Errorf("got %d applied and %d unmatched rules, want %d and %d", len(applied), len(unmatched), tt.applied, tt.unmatched)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package quantizer
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// statClusters is the number of clusters used to collect the image color statistics
+// when selecting the colors of a fixed palette.
+const statClusters = 255
+
+// clusterStats holds the color and the weight of each cluster in the CIE L*a*b* color space.
+type clusterStats struct {
+	lab    []colorful.Color
+	weight []float64
+}
+
+// SelectPalette chooses the subset of at most n colors from the fixed palette
+// which minimizes the total perceptual error of the image.
+func (q Quant) SelectPalette(img image.Image, n int) color.Palette {
+	_, stats := q.statistics(img)
+	return subsetPalette(q.Palette, stats.selectSubset(labPalette(q.Palette), n))
+}
+
+// quantizeFixed quantizes the image using at most nq colors of the fixed palette.
+func (q Quant) quantizeFixed(img image.Image, nq int) image.Image {
+	pi, stats := q.statistics(img)
+	subset := subsetPalette(q.Palette, stats.selectSubset(labPalette(q.Palette), nq))
+	return mapToPalette(pi, subset)
+}
+
+// statistics clusters the image pixels with a fine median cut, returning the clustered image
+// together with the color and the weight of each cluster.
+func (q Quant) statistics(img image.Image) (*image.Paletted, clusterStats) {
+	qz := newQuantizer(img, statClusters, q.AlphaThreshold)
+	qz.Weights = q.Weights
+	qz.cluster()
+	pi := qz.Paletted().(*image.Paletted)
+
+	stats := clusterStats{
+		lab:    labPalette(pi.Palette[:len(qz.cs)]),
+		weight: make([]float64, len(qz.cs)),
+	}
+	for i := range qz.cs {
+		for _, p := range qz.cs[i].px {
+			stats.weight[i] += qz.weight(p)
+		}
+	}
+	return pi, stats
+}
+
+// selectSubset returns the indexes of at most n palette colors minimizing the weighted squared distance
+// between the clusters and their closest selected color. The subset is built greedily,
+// then refined with a local search swapping selected and unselected colors while the error decreases.
+func (s clusterStats) selectSubset(lab []colorful.Color, n int) []int {
+	if n < 1 {
+		n = 1
+	}
+	if n >= len(lab) {
+		subset := make([]int, len(lab))
+		for i := range subset {
+			subset[i] = i
+		}
+		return subset
+	}
+	// dist holds the squared distances between each palette color and each cluster.
+	dist := make([][]float64, len(lab))
+	for i, pc := range lab {
+		dist[i] = make([]float64, len(s.lab))
+		for j, cc := range s.lab {
+			dist[i][j] = sq(pc.R-cc.R) + sq(pc.G-cc.G) + sq(pc.B-cc.B)
+		}
+	}
+	cost := func(subset []int) float64 {
+		var total float64
+		for j := range s.lab {
+			best := -1.0
+			for _, i := range subset {
+				if best < 0 || dist[i][j] < best {
+					best = dist[i][j]
+				}
+			}
+			total += best * s.weight[j]
+		}
+		return total
+	}
+
+	// Greedy selection
+	var (
+		subset   []int
+		selected = make([]bool, len(lab))
+		err      float64
+	)
+	for len(subset) < n {
+		best, bestErr := -1, 0.0
+		for i := range lab {
+			if selected[i] {
+				continue
+			}
+			if e := cost(append(subset, i)); best < 0 || e < bestErr {
+				best, bestErr = i, e
+			}
+		}
+		subset = append(subset, best)
+		selected[best] = true
+		err = bestErr
+	}
+
+	// Local search
+	for improved := true; improved; {
+		improved = false
+		for k := range subset {
+			for i := range lab {
+				if selected[i] {
+					continue
+				}
+				prev := subset[k]
+				subset[k] = i
+				if e := cost(subset); e < err {
+					err = e
+					selected[prev], selected[i] = false, true
+					improved = true
+					continue
+				}
+				subset[k] = prev
+			}
+		}
+	}
+	return subset
+}
+
+// subsetPalette returns the palette colors corresponding to the indexes.
+func subsetPalette(p color.Palette, subset []int) color.Palette {
+	sp := make(color.Palette, len(subset))
+	for i, idx := range subset {
+		sp[i] = p[idx]
+	}
+	return sp
+}
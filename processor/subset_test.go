@@ -0,0 +1,76 @@
+package quantizer
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+func TestSelectSubset(t *testing.T) {
+	// Two clusters of the same weight lie on the palette colors 0 and 2, the color 1 lying halfway between them.
+	// The greedy pass first picks the color 1, which the local search swaps for the color left out.
+	var (
+		lab = []colorful.Color{{R: 0.2}, {R: 0.5}, {R: 0.8}, {R: 0.5, G: 0.5}}
+		s   = clusterStats{
+			lab:    []colorful.Color{{R: 0.2}, {R: 0.8}},
+			weight: []float64{1, 1},
+		}
+	)
+	tests := []struct {
+		n    int
+		want []int
+	}{
+		{0, []int{1}},
+		{1, []int{1}},
+		{2, []int{0, 2}},
+		{4, []int{0, 1, 2, 3}},
+		{5, []int{0, 1, 2, 3}},
+	}
+	for _, tt := range tests {
+		got := s.selectSubset(lab, tt.n)
+		sort.Ints(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("n %d: got %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSelectPalette(t *testing.T) {
+	var (
+		red    = color.NRGBA{R: 0xc9, G: 0x1a, B: 0x09, A: 0xff}
+		blue   = color.NRGBA{G: 0x55, B: 0xbf, A: 0xff}
+		yellow = color.NRGBA{R: 0xf2, G: 0xcd, B: 0x37, A: 0xff}
+		white  = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+		black  = color.NRGBA{R: 0x05, G: 0x13, B: 0x1d, A: 0xff}
+		img    = image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	)
+	// Shades of red and blue, close to the red and blue palette colors.
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 20; x++ {
+			c := color.NRGBA{R: 0xd0, G: uint8(0x10 + y), B: 0x10, A: 0xff}
+			if x >= 10 {
+				c = color.NRGBA{G: uint8(0x50 + y), B: 0xc0, A: 0xff}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	q := Quant{Palette: color.Palette{white, yellow, red, black, blue}}
+	got := q.SelectPalette(img, 2)
+	if len(got) != 2 || !containsColor(got, red) || !containsColor(got, blue) {
+		t.Errorf("got palette %v, want red and blue", got)
+	}
+}
+
+// containsColor checks if the palette holds the color.
+func containsColor(p color.Palette, c color.Color) bool {
+	for _, pc := range p {
+		if pc == c {
+			return true
+		}
+	}
+	return false
+}
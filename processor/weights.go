@@ -0,0 +1,120 @@
+package quantizer
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// MaskWeights scales the grayscale mask to the provided bounds and returns it as a weight map.
+// Brighter mask regions are considered more important when allocating the palette colors.
+func MaskWeights(mask image.Image, bounds image.Rectangle) *image.Gray {
+	var (
+		mb      = mask.Bounds()
+		weights = image.NewGray(bounds)
+	)
+	if mb.Empty() {
+		return weights
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		my := mb.Min.Y + (y-bounds.Min.Y)*mb.Dy()/bounds.Dy()
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			mx := mb.Min.X + (x-bounds.Min.X)*mb.Dx()/bounds.Dx()
+			weights.Set(x, y, color.GrayModel.Convert(mask.At(mx, my)))
+		}
+	}
+	return weights
+}
+
+// CenterWeights generates a weight map which favors the image center and fades out towards the borders.
+func CenterWeights(bounds image.Rectangle) *image.Gray {
+	var (
+		weights = image.NewGray(bounds)
+		cx      = float64(bounds.Min.X) + float64(bounds.Dx())/2
+		cy      = float64(bounds.Min.Y) + float64(bounds.Dy())/2
+	)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		dy := (float64(y) + 0.5 - cy) / (float64(bounds.Dy()) / 2)
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			dx := (float64(x) + 0.5 - cx) / (float64(bounds.Dx()) / 2)
+			// Elliptic distance from the center, normalized to the image corners.
+			d := math.Min(1, math.Sqrt((dx*dx+dy*dy)/2))
+			weights.SetGray(x, y, color.Gray{Y: uint8(math.Round((1 - d*d) * 255))})
+		}
+	}
+	return weights
+}
+
+// EdgeWeights generates a weight map based on the density of the image edges,
+// since the detailed regions are usually the subject of the image.
+func EdgeWeights(img image.Image) *image.Gray {
+	var (
+		bounds = img.Bounds()
+		lum    = image.NewGray(bounds)
+		edges  = image.NewNRGBA(bounds)
+		maxMag float64
+	)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			lum.Set(x, y, img.At(x, y))
+		}
+	}
+	at := func(x, y int) float64 {
+		x = clampInt(x, bounds.Min.X, bounds.Max.X-1)
+		y = clampInt(y, bounds.Min.Y, bounds.Max.Y-1)
+		return float64(lum.GrayAt(x, y).Y)
+	}
+	// Sobel operator
+	mag := make([]float64, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			m := math.Sqrt(gx*gx + gy*gy)
+			mag[(y-bounds.Min.Y)*bounds.Dx()+(x-bounds.Min.X)] = m
+			maxMag = math.Max(maxMag, m)
+		}
+	}
+	if maxMag == 0 {
+		return CenterWeights(bounds)
+	}
+	for i, m := range mag {
+		v := uint8(m / maxMag * 255)
+		edges.Pix[i*4], edges.Pix[i*4+1], edges.Pix[i*4+2], edges.Pix[i*4+3] = v, v, v, 0xff
+	}
+	// Spread the edges to obtain their density.
+	sigma := math.Max(1, float64(minInt(bounds.Dx(), bounds.Dy()))/20)
+	density := gaussianBlur(edges, sigma)
+
+	var maxDensity uint8
+	for i := 0; i < len(density.Pix); i += 4 {
+		if density.Pix[i] > maxDensity {
+			maxDensity = density.Pix[i]
+		}
+	}
+	if maxDensity == 0 {
+		return CenterWeights(bounds)
+	}
+	weights := image.NewGray(bounds)
+	for i := range weights.Pix {
+		weights.Pix[i] = uint8(int(density.Pix[i*4]) * 255 / int(maxDensity))
+	}
+	return weights
+}
+
+// weight returns the importance of the pixel. Every pixel keeps a minimal weight,
+// so the less important regions are still represented in the palette.
+func (q *Quant) weight(p point) float64 {
+	if q.Weights == nil {
+		return 1
+	}
+	return (float64(q.Weights.GrayAt(p.x, p.y).Y) + 1) / 256
+}
+
+// minInt returns the smallest number between two integers.
+func minInt(x, y int) int {
+	if x < y {
+		return x
+	}
+	return y
+}
@@ -0,0 +1,49 @@
+package quantizer
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestWeightsKeepSmallRegion(t *testing.T) {
+	var (
+		img  = image.NewNRGBA(image.Rect(0, 0, 40, 40))
+		mask = image.NewGray(img.Bounds())
+		red  = color.NRGBA{R: 0xe0, G: 0x10, B: 0x10, A: 0xff}
+	)
+	// A dark gray region with a small red patch, the mask highlighting the patch, next to a larger region of light gray stripes.
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			c := color.NRGBA{R: 0x20, G: 0x20, B: 0x20, A: 0xff}
+			switch {
+			case x < 4 && y < 4:
+				c = red
+				mask.SetGray(x, y, color.Gray{Y: 0xff})
+			case x >= 16 && y%2 == 0:
+				c = color.NRGBA{R: 0xa0, G: 0xa0, B: 0xa0, A: 0xff}
+			case x >= 16:
+				c = color.NRGBA{R: 0xe0, G: 0xe0, B: 0xe0, A: 0xff}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	hasRed := func(p color.Palette) bool {
+		for _, c := range p {
+			if color.NRGBAModel.Convert(c) == red {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Without weights the colors go to the larger gray regions.
+	if p := (Quant{}).Quantize(img, 3).(*image.Paletted).Palette; hasRed(p) {
+		t.Errorf("got palette %v without weights, want no red", p)
+	}
+	// The weighted red patch outweighs the light gray region, so the dark region is split first.
+	q := Quant{Weights: MaskWeights(mask, img.Bounds())}
+	if p := q.Quantize(img, 3).(*image.Paletted).Palette; !hasRed(p) {
+		t.Errorf("got palette %v with weights, want red", p)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/esimov/legoizer/drawer"
+)
+
+// export is an output file written after the image is processed.
+type export struct {
+	path  string
+	write func(io.Writer) error
+}
+
+// options holds the settings applied on each processed input.
+type options struct {
+	colors, size, delay int
+	weights             string
+	ldraw, mesh, parts  string
+	instr, format       string
+	group               bool
+	enc                 encoding
+}
+
+// renderSettings holds the options of the render command besides the image processing options.
+type renderSettings struct {
+	delay, workers, quality, seed                                *int
+	out, ldraw, mesh, parts, instr, name, compress, format, logo *string
+	noise                                                        *float64
+	group, paletted, mono, gauss                                 *bool
+}
+
+// newRenderSettings registers the options of the render command besides the image processing options.
+// These include the options of all the other commands.
+func newRenderSettings(fs *flag.FlagSet) *renderSettings {
+	return &renderSettings{
+		logo:     fs.String("logo", "", "Text embossed on each stud"),
+		noise:    fs.Float64("noise", 10, "Noise amount (0 disables the noise)"),
+		mono:     fs.Bool("mono", true, "Apply the same noise value to every color channel"),
+		gauss:    fs.Bool("gauss", false, "Use gaussian noise instead of uniform noise"),
+		seed:     fs.Int("seed", 1, "Noise seed"),
+		delay:    fs.Int("delay", 10, "Frame delay of an image sequence written as an animated GIF, in 100ths of a second"),
+		out:      fs.String("out", "", "Output path, required. - writes to the standard output. A .gif output or a numbered sequence pattern legoizes every frame of an animated GIF or image sequence input. The output directory in batch mode"),
+		ldraw:    fs.String("ldraw", "", "LDraw model output path"),
+		mesh:     fs.String("mesh", "", "3D mesh output path. The format is detected from the extension: .stl, .obj (with a .mtl material library) or .3mf"),
+		group:    fs.Bool("group", false, "Group the mesh bricks of the same color into one object per color, e.g. to assign the printer materials. Each brick stays a separate shell"),
+		parts:    fs.String("parts", "", "Per layer parts list output path (CSV)"),
+		instr:    fs.String("instructions", "", "Building instructions output path"),
+		name:     fs.String("name", "{name}.png", "Batch output file name template. Accepts the {name}, {ext} and {index} placeholders, which are also expanded in the export paths"),
+		workers:  fs.Int("workers", 0, "Number of images processed in parallel in batch mode. Defaults to the number of CPUs"),
+		quality:  fs.Int("quality", 100, "JPEG output quality (1-100)"),
+		compress: fs.String("compression", "default", "PNG output compression: default, none, fast or best"),
+		paletted: fs.Bool("paletted", false, "Write the PNG output as an 8-bit paletted image, for small files"),
+		format:   fs.String("format", "", "Output image format: png, jpg or gif. Detected from the output extension if empty, PNG on the standard output"),
+	}
+}
+
+// runRender runs the render command.
+func runRender(args []string) int {
+	var (
+		fs = newFlagSet("render", "Generate the legoized image")
+		s  = newSettings(fs)
+		r  = newRenderSettings(fs)
+	)
+	fs.Lookup("in").Usage = "Input path, - for the standard input, a numbered image sequence pattern, e.g. frame_%04d.png, or a directory or glob pattern for batch processing"
+	if err := parseArgs(fs, s, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	// Check the output before processing the image.
+	out := *r.out
+	switch {
+	case isBatch(*s.in) && out == "":
+		fmt.Fprintln(os.Stderr, "missing output directory: set -out")
+		return exitUsage
+	case isBatch(*s.in):
+		out = *r.name
+	case out == "":
+		fmt.Fprintln(os.Stderr, "missing output path: set -out, or -out - for the standard output")
+		return exitUsage
+	}
+	if err := checkFormat(outputFormat(out, *r.format)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	// The exported pieces should come in existing colors.
+	if *s.palPath == "" && (*r.ldraw != "" || *r.mesh != "" || *r.parts != "" || *r.instr != "") {
+		*s.palPath = "system"
+	}
+	quant, pal, err := s.quantizer()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	if *r.ldraw != "" && !quant.System.HasLDraw() {
+		fmt.Fprintf(os.Stderr, "the %s brick system has no LDraw parts, set -system to standard or duplo for the LDraw export\n", quant.System.Name)
+		return exitUsage
+	}
+	quant.Logo = *r.logo
+	quant.Noise = drawer.Noise{
+		Amount:     *r.noise,
+		Monochrome: *r.mono,
+		Gaussian:   *r.gauss,
+		Seed:       *r.seed,
+	}
+	enc, err := newEncoding(*r.quality, *r.compress, *r.paletted, quant.AlphaThreshold)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	opts := options{
+		colors:  *s.colors,
+		size:    *s.legoSize,
+		delay:   *r.delay,
+		weights: *s.weights,
+		ldraw:   *r.ldraw,
+		mesh:    *r.mesh,
+		group:   *r.group,
+		parts:   *r.parts,
+		instr:   *r.instr,
+		format:  *r.format,
+		enc:     enc,
+	}
+	if isBatch(*s.in) {
+		quant.Quiet = true
+		results := runBatch(quant, opts, *s.in, *r.out, *r.name, *r.workers)
+		printSummary(os.Stdout, results)
+		status := exitOK
+		for _, res := range results {
+			if res.err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", res.in, res.err)
+				status = exitFailure
+			}
+		}
+		return status
+	}
+
+	// Keep the standard output for the image when it's written there.
+	var log io.Writer = os.Stdout
+	if *r.out == stdio {
+		log = os.Stderr
+		quant.Quiet = true
+	}
+	fmt.Fprintln(log, "Generating the legoized image...")
+	now := time.Now()
+
+	if _, err := legoize(&quant, opts, *s.in, *r.out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	since := time.Since(now)
+	fmt.Fprintln(log, "\n  Done✓")
+	fmt.Fprintf(log, "Generated in: %.2fs\n", since.Seconds())
+
+	if *s.palPath != "" {
+		fmt.Fprintf(log, "Palette colors used (%d):\n", len(quant.Used))
+		for _, c := range quant.Used {
+			fmt.Fprintf(log, "  %v\n", pal.Name(c))
+		}
+	}
+	if len(quant.Seams) > 0 {
+		fmt.Fprintf(log, "Weak columns (%d):\n", len(quant.Seams))
+		for _, s := range quant.Seams {
+			fmt.Fprintf(log, "  joint left of column %d, rows %d-%d\n", s.X, s.Y, s.Y+s.Rows-1)
+		}
+	}
+	if len(quant.Remapped) > 0 {
+		fmt.Fprintln(log, "Remapped colors:")
+		for _, s := range quant.Remapped {
+			fmt.Fprintf(log, "  %v → %v\n", pal.Name(s.From), pal.Name(s.To))
+		}
+	}
+	for _, s := range quant.Unmatched {
+		fmt.Fprintf(os.Stderr, "warning: the remap rule %v → %v matched no palette color\n", pal.Name(s.From), pal.Name(s.To))
+	}
+	warnUncovered(&quant)
+	return exitOK
+}
+
+// warnUncovered warns about the studs left uncovered by the last processed image layout.
+func warnUncovered(quant *drawer.Quantizer) {
+	if len(quant.Uncovered) == 0 {
+		return
+	}
+	p := quant.Uncovered[0]
+	fmt.Fprintf(os.Stderr, "warning: no %s shape fits in %d studs, which are left uncovered, the first one at %d,%d\n",
+		quant.System.Name, len(quant.Uncovered), p.X, p.Y)
+}
+
+// legoize processes the input image, or all the frames of an animation, then writes the output image and the exports.
+// It returns the bounds of the input image.
+func legoize(quant *drawer.Quantizer, opts options, inPath, outPath string) (image.Rectangle, error) {
+	anim, err := loadAnimation(inPath, opts.delay)
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("failed to open image '%v': %v", inPath, err)
+	}
+	img := anim.frames[0]
+	if err := setWeights(quant, opts.weights, img); err != nil {
+		return img.Bounds(), err
+	}
+
+	format := outputFormat(outPath, opts.format)
+	if animated, sequence := format == "gif", isSequence(outPath); animated || sequence {
+		// Render all the frames with the same palette and keep the bricks of the unchanged studs, so the frames do not flicker.
+		if len(anim.frames) > 1 {
+			quant.SharePalette(anim.frames, opts.colors)
+			quant.Temporal = true
+		}
+		for i, frame := range anim.frames {
+			if !quant.Quiet {
+				fmt.Printf("\nFrame %d/%d\n", i+1, len(anim.frames))
+			}
+			anim.frames[i] = quant.Process(frame, opts.colors, opts.size)
+		}
+		if sequence {
+			err = generateSequence(anim, outPath, format, opts.enc)
+		} else {
+			err = generateAnimation(anim, outPath, quant.AlphaThreshold)
+		}
+	} else {
+		err = generateImage(quant.Process(img, opts.colors, opts.size), outPath, format, opts.enc)
+	}
+	if err != nil {
+		return img.Bounds(), fmt.Errorf("failed to write '%v': %v", outPath, err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(outPath), filepath.Ext(outPath))
+	if outPath == stdio {
+		name = "legoizer"
+	}
+	exports := []export{
+		{opts.ldraw, func(w io.Writer) error { return drawer.WriteLDraw(w, name, quant.Layers, quant.System, quant.Wall) }},
+		{opts.parts, func(w io.Writer) error { return drawer.WriteParts(w, quant.Layers, quant.System) }},
+		{opts.instr, func(w io.Writer) error { return drawer.WriteInstructions(w, quant.Layers, quant.System) }},
+	}
+	if opts.mesh != "" {
+		mesh, err := drawer.NewMesh(quant.Layers, quant.System, quant.Wall, opts.group)
+		if err != nil {
+			return img.Bounds(), fmt.Errorf("failed to build the mesh: %v", err)
+		}
+		switch ext := strings.ToLower(filepath.Ext(opts.mesh)); ext {
+		case ".stl":
+			exports = append(exports, export{opts.mesh, mesh.WriteSTL})
+		case ".obj":
+			mtl := mtlPath(opts.mesh)
+			exports = append(exports,
+				export{opts.mesh, func(w io.Writer) error { return mesh.WriteOBJ(w, filepath.Base(mtl)) }},
+				export{mtl, mesh.WriteMTL},
+			)
+		case ".3mf":
+			exports = append(exports, export{opts.mesh, mesh.Write3MF})
+		default:
+			return img.Bounds(), fmt.Errorf("unsupported mesh format: %v", ext)
+		}
+	}
+	for _, e := range exports {
+		if e.path == "" {
+			continue
+		}
+		if err := writeFile(e.path, e.write); err != nil {
+			return img.Bounds(), fmt.Errorf("failed to write '%v': %v", e.path, err)
+		}
+	}
+	return img.Bounds(), nil
+}
+
+// mtlPath returns the path of the material library written next to an OBJ mesh.
+func mtlPath(mesh string) string {
+	return strings.TrimSuffix(mesh, filepath.Ext(mesh)) + ".mtl"
+}